@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   string
+		format  string
+		wantErr bool
+		check   func(t *testing.T, out string)
+	}{
+		{
+			name:   "text",
+			level:  "info",
+			format: "text",
+			check: func(t *testing.T, out string) {
+				if !strings.Contains(out, `level=INFO msg="🏠 Room created" room=LOBBY`) {
+					t.Errorf("output = %q, want a text line", out)
+				}
+			},
+		},
+		{
+			name:   "json",
+			level:  "info",
+			format: "JSON",
+			check: func(t *testing.T, out string) {
+				var line map[string]any
+				if err := json.Unmarshal([]byte(out), &line); err != nil {
+					t.Fatalf("output %q is not JSON: %v", out, err)
+				}
+				if line["level"] != "INFO" || line["msg"] != "🏠 Room created" || line["room"] != "LOBBY" {
+					t.Errorf("output = %v", line)
+				}
+			},
+		},
+		{
+			name:   "debug filtered at info",
+			level:  "info",
+			format: "text",
+			check: func(t *testing.T, out string) {
+				if strings.Contains(out, "level=DEBUG") {
+					t.Errorf("output = %q, want no debug line", out)
+				}
+			},
+		},
+		{
+			name:   "debug shown at debug",
+			level:  "debug",
+			format: "text",
+			check: func(t *testing.T, out string) {
+				if !strings.Contains(out, `level=DEBUG msg="🔍 Message sent" room=LOBBY`) {
+					t.Errorf("output = %q, want a debug line", out)
+				}
+			},
+		},
+		{name: "unknown level", level: "loud", format: "text", wantErr: true},
+		{name: "unknown format", level: "info", format: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := newLogger(&buf, tt.level, tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("newLogger succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newLogger: %v", err)
+			}
+
+			logger.Debug("🔍 Message sent", "room", "LOBBY")
+			logger.Info("🏠 Room created", "room", "LOBBY")
+			tt.check(t, buf.String())
+		})
+	}
+}
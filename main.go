@@ -1,24 +1,100 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
+
+	"github.com/biramendoye/room-cast/roomcast"
 )
 
-const defaultPort int = 11111
+// shutdownTimeout bounds how long the rooms have to disconnect their
+// members when the server stops.
+const shutdownTimeout = 10 * time.Second
 
 func main() {
-	port := flag.Int("port", defaultPort, "server port (default: 11111)")
+	cfg := roomcast.DefaultConfig()
+	flag.IntVar(&cfg.Port, "port", cfg.Port, "server port (default: 11111)")
+	flag.StringVar(&cfg.MetricsAddr, "metrics-addr", cfg.MetricsAddr, "address serving Prometheus metrics at /metrics, e.g. :9100 (disabled when empty)")
+	flag.StringVar(&cfg.AdminAddr, "admin-addr", cfg.AdminAddr, "address of the HTTP admin endpoint, e.g. 127.0.0.1:9090 (disabled when empty)")
+	flag.StringVar(&cfg.AdminPassword, "admin-password", cfg.AdminPassword, "password for /admin, admin commands are disabled when empty")
+	flag.Float64Var(&cfg.RateLimit, "rate", cfg.RateLimit, "messages per second allowed per client, 0 disables rate limiting")
+	flag.IntVar(&cfg.RateBurst, "burst", cfg.RateBurst, "messages a client may send in a burst")
+	flag.DurationVar(&cfg.ViolationWindow, "violation-window", cfg.ViolationWindow, "how long rate limit violations are remembered")
+	flag.DurationVar(&cfg.CooldownBase, "cooldown", cfg.CooldownBase, "send cooldown after repeated rate limit violations, doubled each time")
+	flag.DurationVar(&cfg.CooldownMax, "max-cooldown", cfg.CooldownMax, "longest send cooldown")
+	flag.IntVar(&cfg.KickAfterViolations, "kick-after", cfg.KickAfterViolations, "disconnect clients after this many violations, 0 never kicks")
+	flag.IntVar(&cfg.ByteRate, "byte-rate", cfg.ByteRate, "bytes per second allowed per client, 0 disables the limit")
+	flag.DurationVar(&cfg.ByteRateWindow, "byte-rate-window", cfg.ByteRateWindow, "sliding window over which --byte-rate is measured")
+	flag.IntVar(&cfg.MaxClients, "max-clients", cfg.MaxClients, "most members a room holds at once")
+	flag.IntVar(&cfg.MaxConnsPerIP, "max-conns-per-ip", cfg.MaxConnsPerIP, "most client connections open at once from one IP address, 0 means no limit")
+	flag.IntVar(&cfg.MaxRoomsPerUser, "max-rooms-per-user", cfg.MaxRoomsPerUser, "most rooms a username may create, 0 means no limit")
+	flag.DurationVar(&cfg.KeepAlivePeriod, "keepalive-period", cfg.KeepAlivePeriod, "interval between TCP keepalive probes, 0 keeps the system default")
+	flag.DurationVar(&cfg.Heartbeat, "heartbeat", cfg.Heartbeat, "send a PING to clients silent for this long and disconnect those missing 3 in a row, 0 disables it")
+	flag.DurationVar(&cfg.PasteWindow, "paste-window", cfg.PasteWindow, "send lines arriving within this long of each other as a single message, e.g. 10ms, 0 sends each line on its own")
+	flag.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout, "disconnect clients that haven't sent a message for this long, 0 never does")
+	flag.DurationVar(&cfg.SetupTimeout, "setup-timeout", cfg.SetupTimeout, "time new clients have to choose a username and room, 0 waits forever")
+	flag.DurationVar(&cfg.WriteTimeout, "write-timeout", cfg.WriteTimeout, "deadline for each write to a client, 0 disables it")
+	flag.DurationVar(&cfg.DrainTimeout, "drain-timeout", cfg.DrainTimeout, "disconnect clients whose queued messages haven't been written for this long, 0 disables it")
+	flag.StringVar(&cfg.UsernamePattern, "username-pattern", cfg.UsernamePattern, "regular expression usernames must match")
+	flag.StringVar(&cfg.RoomNamePattern, "room-pattern", cfg.RoomNamePattern, "regular expression room names must match")
+	flag.IntVar(&cfg.MinUsernameLength, "min-username", cfg.MinUsernameLength, "fewest characters in a username")
+	flag.IntVar(&cfg.MaxUsernameLength, "max-username", cfg.MaxUsernameLength, "most characters in a username")
+	flag.IntVar(&cfg.NameDisplayWidth, "name-width", cfg.NameDisplayWidth, "characters of a name shown before it is cut, 0 shows names in full")
+	flag.DurationVar(&cfg.RejoinTTL, "rejoin-ttl", cfg.RejoinTTL, "how long the last room of a user is remembered for /rejoin, 0 disables it")
+	flag.StringVar(&cfg.WSAddr, "ws-addr", cfg.WSAddr, "address of the WebSocket gateway for browser clients, e.g. :8080 (disabled when empty)")
+	flag.StringVar(&cfg.FederationAddr, "federation-addr", cfg.FederationAddr, "address peer servers link to, e.g. :11112 (disabled when empty)")
+	flag.StringVar(&cfg.FederationSecret, "federation-secret", cfg.FederationSecret, "secret shared by federated servers")
+	flag.StringVar(&cfg.Motd, "motd", cfg.Motd, "message of the day shown when joining a room, admins can override it per room with /setmotd")
+	flag.IntVar(&cfg.HistoryLimit, "history-limit", cfg.HistoryLimit, "messages kept in each room's history, 0 keeps everything")
+	flag.IntVar(&cfg.HistoryQueue, "history-queue", cfg.HistoryQueue, "messages each room queues for a background writer that saves them to its history in batches, 0 saves them as they are sent")
+	flag.StringVar(&cfg.HistoryOverflow, "history-overflow", cfg.HistoryOverflow, "what happens when a history queue is full: block, waiting for the writer, or drop, leaving the message out of the history with a warning")
+	flag.BoolVar(&cfg.HistoryOnJoin, "history-on-join", cfg.HistoryOnJoin, "send the room history to clients when they join, use --history-on-join=false to keep it private")
+	flag.StringVar(&cfg.HistoryDir, "history-dir", cfg.HistoryDir, "directory holding the room history files, created if missing")
+	flag.Float64Var(&cfg.JoinRate, "join-rate", cfg.JoinRate, "members per second a room admits, 0 disables admission control")
+	flag.IntVar(&cfg.JoinBurst, "join-burst", cfg.JoinBurst, "members a room admits in a burst")
+	flag.StringVar(&cfg.LineSpacing, "line-spacing", cfg.LineSpacing, "how messages are spaced in terminals: compact, one under the other, or spaced, with a blank line between them")
+	flag.StringVar(&cfg.Protocol, "protocol", cfg.Protocol, "how clients exchange messages: line, one per line of text, or framed, a 4-byte big-endian length followed by JSON")
+	flag.BoolVar(&cfg.ProxyProtocol, "proxy-protocol", cfg.ProxyProtocol, "expect a PROXY protocol v1 header from a trusted load balancer on every connection")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "certificate file (PEM) to accept TLS connections, requires --tls-key")
+	flag.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "private key file (PEM) matching --tls-cert")
+	clean := flag.Bool("clean-history", false, "convert the text history files saved by older versions to JSON lines, then exit")
+	logLevel := flag.String("log-level", "info", "least severe messages logged: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "log output format: text or json")
+	peers := flag.String("peers", "", "comma-separated addresses of peer servers to federate with")
 	flag.Parse()
 
+	logger, err := newLogger(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	slog.SetDefault(logger)
+
+	if *peers != "" {
+		cfg.Peers = strings.Split(*peers, ",")
+	}
+
+	if *clean {
+		if err := roomcast.CleanHistory(cfg.HistoryDir); err != nil {
+			log.Fatalf("❌ Failed to clean history: %v", err)
+		}
+		return
+	}
+
 	// Create and start server
-	server := NewServer(*port)
+	server, err := roomcast.NewServer(cfg)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
 
 	go func() {
-		if err := server.Start(); err != nil {
+		if err := server.Start(context.Background()); err != nil {
 			log.Fatalf("❌ Server error: %v", err)
 		}
 	}()
@@ -27,10 +103,45 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	<-sigChan // Wait for Ctrl+C
-	log.Println("🛑 Received shutdown signal!")
+	// Operators can also type commands on stdin
+	consoleStop := make(chan struct{})
+	go server.RunConsole(os.Stdin, os.Stdout, consoleStop)
 
-	server.Shutdown() // Clean up rooms and close connections
+	// Dump diagnostics to the log on SIGUSR1
+	diagChan := make(chan os.Signal, 1)
+	notifyDiagnostics(diagChan)
+
+wait:
+	for {
+		select {
+		case <-diagChan:
+			slog.Info(server.Diagnostics())
+		case <-sigChan: // Wait for Ctrl+C
+			slog.Info("🛑 Received shutdown signal!")
+			break wait
+		case <-consoleStop:
+			slog.Info("🛑 Shutdown requested from the console!")
+			break wait
+		}
+	}
+
+	// Clean up rooms and close connections, still watching for signals
+	// so that a second Ctrl+C doesn't leave the operator waiting
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- server.Shutdown(ctx) }()
+
+	select {
+	case err := <-shutdownErr:
+		if err != nil {
+			slog.Error("❌ Shutdown incomplete", "err", err)
+			return
+		}
+	case <-sigChan:
+		slog.Warn("💥 Received a second shutdown signal, forcing exit without waiting for rooms to drain!")
+		os.Exit(1)
+	}
 
-	log.Println("👋 Server exited gracefully.")
+	slog.Info("👋 Server exited gracefully.")
 }
@@ -0,0 +1,192 @@
+package roomcast
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerCommand("admin", adminCommand)
+	registerAdminCommand("idle", idleCommand)
+	registerAdminCommand("mutes", mutesCommand)
+	registerAdminCommand("serverstats", serverStatsCommand)
+	registerAdminCommand("flush", flushCommand)
+	registerAdminCommand("logging", loggingCommand)
+}
+
+// adminCommand handles "/admin <password>": it grants admin rights
+// when the password matches the one configured on the server.
+func adminCommand(c *Client, args []string) {
+	password := c.server.cfg.AdminPassword
+	if password == "" {
+		c.writeError(CodeForbidden, "Admin commands are disabled on this server.")
+		return
+	}
+	if len(args) != 1 {
+		c.writeError(CodeUsage, "Usage: /admin <password>")
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(args[0]), []byte(password)) != 1 {
+		slog.Warn("🚨 Failed admin login", "user", c.name())
+		c.writeError(CodeWrongPassword, "Wrong admin password.")
+		return
+	}
+
+	c.mu.Lock()
+	c.admin = true
+	c.mu.Unlock()
+
+	slog.Info("🔑 Admin login", "user", c.name())
+	c.writeMessage([]byte("🔑 You are now an admin.\n"))
+}
+
+// requireAdmin tells the client off and returns false if it isn't an admin.
+func requireAdmin(c *Client) bool {
+	if c.isAdmin() {
+		return true
+	}
+	c.writeError(CodeForbidden, "This command is reserved to admins.")
+	return false
+}
+
+// idleCommand handles "/idle" (admin): it lists the members of the
+// current room by how long they have been silent, longest first.
+func idleCommand(c *Client, args []string) {
+	type idleMember struct {
+		name string
+		idle time.Duration
+	}
+
+	room := c.currentRoom()
+	var members []idleMember
+	room.do(func() {
+		for client := range room.clients {
+			members = append(members, idleMember{client.label(), client.idleFor()})
+		}
+	})
+	sort.Slice(members, func(i, j int) bool { return members[i].idle > members[j].idle })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "💤 Idle times in %s:\n", room.name)
+	for _, m := range members {
+		fmt.Fprintf(&b, "%s: %v\n", m.name, m.idle.Round(time.Second))
+	}
+	c.writeMessage([]byte(b.String()))
+}
+
+// mutesCommand handles "/mutes" (admin): it lists the clients that
+// are currently muted, with the reason and when the mute ends.
+func mutesCommand(c *Client, args []string) {
+	c.server.mu.RLock()
+	clients := make([]*Client, 0, len(c.server.clients))
+	for client := range c.server.clients {
+		clients = append(clients, client)
+	}
+	c.server.mu.RUnlock()
+
+	now := time.Now()
+	var lines []string
+	for _, client := range clients {
+		client.mu.Lock()
+		until := client.mutedUntil
+		client.mu.Unlock()
+
+		if until.After(now) {
+			lines = append(lines, fmt.Sprintf("%s: flooding, until %s (%v left)\n",
+				client.name(), until.Format("15:04:05"), until.Sub(now).Round(time.Second)))
+		}
+	}
+
+	if len(lines) == 0 {
+		c.writeMessage([]byte("📭 Nobody is muted.\n"))
+		return
+	}
+	sort.Strings(lines)
+	c.writeMessage([]byte(fmt.Sprintf("🔇 %d muted users:\n%s", len(lines), strings.Join(lines, ""))))
+}
+
+// serverStatsCommand handles "/serverstats" (admin): it shows totals
+// across all rooms since the server started.
+func serverStatsCommand(c *Client, args []string) {
+	stats := c.server.Stats()
+	var b strings.Builder
+	fmt.Fprintf(&b, "📈 Server stats:\n  clients: %d (peak %d)\n  rooms: %d\n  messages forwarded: %d\n  uptime: %v\n",
+		stats.Clients, stats.PeakClients, stats.Rooms, stats.Messages, stats.Uptime.Round(time.Second))
+	for _, room := range stats.PerRoom {
+		fmt.Fprintf(&b, "  🏠 %s: %d clients, %d messages\n", room.Name, room.Clients, room.Messages)
+	}
+	c.writeMessage([]byte(b.String()))
+}
+
+// flushCommand handles "/flush" (admin): it syncs the history of every
+// room to disk.
+func flushCommand(c *Client, args []string) {
+	s := c.server
+	s.mu.RLock()
+	rooms := make([]*Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		rooms = append(rooms, room)
+	}
+	s.mu.RUnlock()
+
+	var failed []string
+	for _, room := range rooms {
+		if err := room.flush(); err != nil {
+			slog.Error("❌ Error flushing history", "room", room.name, "err", err)
+			failed = append(failed, fmt.Sprintf("%s (%v)", room.name, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		c.writeError(CodeInternal, fmt.Sprintf("Failed to flush the history of %s.", strings.Join(failed, ", ")))
+		return
+	}
+	slog.Info("💾 History flushed", "user", c.name(), "rooms", len(rooms))
+	c.writeMessage([]byte(fmt.Sprintf("💾 History of %d rooms synced to disk.\n", len(rooms))))
+}
+
+// loggingCommand handles "/logging on|off" (admin): it turns saving the
+// messages of the current room to its history file on or off. The
+// history saved so far is kept either way.
+func loggingCommand(c *Client, args []string) {
+	on, ok := parseToggle(args)
+	if !ok {
+		c.writeError(CodeUsage, "Usage: /logging on|off")
+		return
+	}
+	room := c.currentRoom()
+	state := "off"
+	if on {
+		state = "on"
+	}
+
+	room.mu.Lock()
+	changed := room.persist != on
+	room.persist = on
+	room.mu.Unlock()
+
+	if !changed {
+		c.writeMessage([]byte(fmt.Sprintf("📝 Logging is already %s in %s.\n", state, room.name)))
+		return
+	}
+
+	slog.Info("📝 Logging changed", "user", c.name(), "room", room.name, "logging", state)
+	notice := fmt.Sprintf("📝 %s turned logging on, messages are saved again.\n", c.name())
+	if !on {
+		notice = fmt.Sprintf("🙈 %s turned logging off, messages are no longer saved.\n", c.name())
+	}
+	room.do(func() {
+		room.broadcast(&Message{
+			Content: notice,
+			Sender:  c.name(),
+			Type:    NotificationType,
+			Room:    room.name,
+		}, nil)
+	})
+}
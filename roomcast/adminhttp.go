@@ -0,0 +1,69 @@
+package roomcast
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxAnnouncementLength is the maximum number of characters in an
+// announcement sent through the admin endpoint.
+const maxAnnouncementLength = 500
+
+// startAdminHTTP serves the admin endpoint on Config.AdminAddr, if set.
+// It should only be reachable by operators, e.g. on 127.0.0.1.
+func (s *Server) startAdminHTTP() error {
+	if s.cfg.AdminAddr == "" {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", s.cfg.AdminAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for admin requests: %w", err)
+	}
+	s.mu.Lock()
+	s.adminListener = ln
+	s.mu.Unlock()
+	slog.Info("🛠️ Admin endpoint listening", "addr", s.cfg.AdminAddr)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /announce", s.handleAnnounce)
+	httpServer := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go httpServer.Serve(ln)
+	return nil
+}
+
+// handleAnnounce sends the request body as an announcement to every
+// room. When an admin password is set, it must be given as a bearer
+// token.
+func (s *Server) handleAnnounce(w http.ResponseWriter, r *http.Request) {
+	if password := s.cfg.AdminPassword; password != "" {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(password)) != 1 {
+			http.Error(w, "Wrong or missing admin password.", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 4*maxAnnouncementLength))
+	if err != nil {
+		http.Error(w, "Announcement too long.", http.StatusRequestEntityTooLarge)
+		return
+	}
+	text := sanitizeText(string(body), maxAnnouncementLength)
+	if text == "" {
+		http.Error(w, "Send the announcement text as the request body.", http.StatusBadRequest)
+		return
+	}
+
+	rooms := s.announce(text)
+	fmt.Fprintf(w, "📣 Announcement sent to %d rooms.\n", rooms)
+}
@@ -0,0 +1,79 @@
+package roomcast
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnnounceEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		token    string
+		body     string
+		stopped  bool
+		status   int
+		reply    string
+		notice   string
+	}{
+		{name: "two rooms", body: "server restarting in 5 minutes", status: http.StatusOK, reply: "sent to 2 rooms", notice: "📣 server restarting in 5 minutes"},
+		{name: "room shutting down", body: "still there?", stopped: true, status: http.StatusOK, reply: "sent to 2 rooms", notice: "📣 still there?"},
+		{name: "control characters", body: "line one\nline\x1b[2J two", status: http.StatusOK, reply: "sent to 2 rooms", notice: "📣 line one line [2J two"},
+		{name: "password", password: "s3cret", token: "s3cret", body: "hello", status: http.StatusOK, reply: "sent to 2 rooms", notice: "📣 hello"},
+		{name: "wrong password", password: "s3cret", token: "guess", body: "hello", status: http.StatusUnauthorized},
+		{name: "missing password", password: "s3cret", body: "hello", status: http.StatusUnauthorized},
+		{name: "empty", body: " \x07 ", status: http.StatusBadRequest},
+		{name: "too long", body: strings.Repeat("x", 4*maxAnnouncementLength+1), status: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.AdminPassword = tt.password
+			server := startServer(t, cfg)
+			endpoint := httptest.NewServer(http.HandlerFunc(server.handleAnnounce))
+			t.Cleanup(endpoint.Close)
+
+			alice := join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_two")
+			if tt.stopped {
+				room, err := server.getOrCreateRoom("ROOM_THREE", "carol")
+				if err != nil {
+					t.Fatalf("getOrCreateRoom: %v", err)
+				}
+				room.stop()
+				<-room.done
+			}
+
+			req, err := http.NewRequest("POST", endpoint.URL+"/announce", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			reply, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %s, want %d (%s)", resp.Status, tt.status, reply)
+			}
+			if !strings.Contains(string(reply), tt.reply) {
+				t.Errorf("reply = %q, want %q", reply, tt.reply)
+			}
+
+			if tt.notice == "" {
+				alice.refute("📣", 200*time.Millisecond)
+				return
+			}
+			alice.expect(tt.notice + ColorReset)
+			bobby.expect(tt.notice + ColorReset)
+		})
+	}
+}
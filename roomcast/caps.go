@@ -0,0 +1,201 @@
+package roomcast
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"unicode/utf8"
+)
+
+// capsPrefix starts the line a client sends instead of its username to
+// tell the server what it can display, e.g. "caps: color,framing".
+const capsPrefix = "caps:"
+
+// capabilities are what a client can handle, negotiated at connect
+// time. Clients that never negotiate get defaultCapabilities.
+type capabilities struct {
+	// emoji is set when emoji can be shown. Without it they are
+	// replaced with ASCII or left out.
+	emoji bool
+
+	// color is set when ANSI color sequences can be shown.
+	color bool
+
+	// framing is set when messages are exchanged as length-prefixed
+	// JSON frames rather than lines of text.
+	framing bool
+}
+
+var defaultCapabilities = capabilities{emoji: true, color: true}
+
+// parseCapabilities parses the comma-separated capabilities a client
+// advertised. Unknown ones are ignored and missing ones are off.
+func parseCapabilities(list string) capabilities {
+	var caps capabilities
+	for _, name := range strings.Split(list, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "emoji":
+			caps.emoji = true
+		case "color":
+			caps.color = true
+		case "framing":
+			caps.framing = true
+		}
+	}
+	return caps
+}
+
+// String lists the capabilities as a client advertises them.
+func (caps capabilities) String() string {
+	var names []string
+	if caps.emoji {
+		names = append(names, "emoji")
+	}
+	if caps.color {
+		names = append(names, "color")
+	}
+	if caps.framing {
+		names = append(names, "framing")
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// asciiEmoji holds the ASCII shown instead of the emoji that carry
+// meaning in messages and prompts. Other emoji are left out.
+var asciiEmoji = map[rune]string{
+	'💬': ":",
+	'🏠': "@",
+	'❌': "Error:",
+	'🔒': "(private)",
+}
+
+// isEmoji reports whether r is an emoji or one of the invisible runes
+// that combine them.
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF, // pictographs, emoticons, symbols
+		r >= 0x2600 && r <= 0x27BF, // miscellaneous symbols, dingbats
+		r >= 0x2300 && r <= 0x23FF, // technical symbols such as ⏳
+		r >= 0x2B00 && r <= 0x2BFF, // arrows and shapes such as ⭐
+		r == 0x21A9,                // ↩
+		r == 0xFE0F, r == 0x200D, r == 0x20E3:
+		return true
+	}
+	return false
+}
+
+// tailor rewrites text written to a client so that it only uses what
+// the client can display.
+func (caps capabilities) tailor(text []byte) []byte {
+	if !caps.color {
+		text = ansiPattern.ReplaceAll(text, nil)
+	}
+	if caps.emoji {
+		return text
+	}
+
+	out := make([]byte, 0, len(text))
+	dropSpace := false
+	for len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		switch {
+		case isEmoji(r):
+			if ascii, ok := asciiEmoji[r]; ok {
+				out = append(out, ascii...)
+			} else {
+				// Left out along with the space separating it from
+				// the text that follows.
+				dropSpace = true
+			}
+		case r == ' ' && dropSpace:
+			dropSpace = false
+		default:
+			dropSpace = false
+			out = append(out, text[:size]...)
+		}
+		text = text[size:]
+	}
+	return out
+}
+
+// capsConn is a text connection whose output is tailored to the
+// capabilities the client negotiated.
+type capsConn struct {
+	net.Conn
+	caps capabilities
+}
+
+func (cc *capsConn) Write(p []byte) (int, error) {
+	if _, err := cc.Conn.Write(cc.caps.tailor(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// capabilitiesOf returns the capabilities negotiated on conn.
+func capabilitiesOf(conn net.Conn) capabilities {
+	switch c := conn.(type) {
+	case *capsConn:
+		return c.caps
+	case *framedConn:
+		return c.caps
+	}
+	return defaultCapabilities
+}
+
+// isFramed reports whether messages on conn are length-prefixed frames.
+func isFramed(conn net.Conn) bool {
+	_, framed := conn.(*framedConn)
+	return framed
+}
+
+// isCompressed reports whether conn goes through zlib compression.
+func isCompressed(conn net.Conn) bool {
+	if cc, ok := conn.(*capsConn); ok {
+		conn = cc.Conn
+	}
+	_, compressed := conn.(*compressedConn)
+	return compressed
+}
+
+// compress switches conn to zlib compression, below the tailoring of
+// its output so that the compressed stream is left alone.
+func compress(conn net.Conn, reader *bufio.Reader) net.Conn {
+	if cc, ok := conn.(*capsConn); ok {
+		return &capsConn{Conn: newCompressedConn(cc.Conn, reader), caps: cc.caps}
+	}
+	return newCompressedConn(conn, reader)
+}
+
+// negotiate applies the capabilities a client advertised with
+// capsPrefix and confirms those it got. A client may negotiate again,
+// but framing, once on, stays on and can't be combined with compression.
+func negotiate(conn net.Conn, list string) net.Conn {
+	caps := parseCapabilities(list)
+	if cc, ok := conn.(*capsConn); ok {
+		conn = cc.Conn
+	}
+
+	if fc, ok := conn.(*framedConn); ok {
+		caps.framing = true
+		fc.caps = caps
+		fc.Write([]byte("✅ CAPS " + caps.String() + "\n"))
+		return fc
+	}
+	if _, compressed := conn.(*compressedConn); compressed {
+		caps.framing = false
+	}
+
+	reply := []byte("✅ CAPS " + caps.String() + "\n")
+	if caps.framing {
+		// The reply is the last line of text before frames.
+		conn.Write(caps.tailor(reply))
+		return &framedConn{Conn: conn, caps: caps}
+	}
+	out := &capsConn{Conn: conn, caps: caps}
+	out.Write(reply)
+	return out
+}
@@ -0,0 +1,52 @@
+package roomcast
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+func init() {
+	registerCommand("catchup", catchupCommand)
+}
+
+// catchupCommand handles "/catchup <seq>": it replays the messages of
+// the current room numbered after seq, for clients that noticed a gap
+// in the sequence numbers. Only the messages kept in memory can be
+// replayed, at most --history-limit.
+func catchupCommand(c *Client, args []string) {
+	if len(args) != 1 {
+		c.writeError(CodeUsage, "Usage: /catchup <sequence number>")
+		return
+	}
+	after, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		c.writeError(CodeUsage, "Usage: /catchup <sequence number>")
+		return
+	}
+
+	room := c.currentRoom()
+	if !room.isLogged() {
+		c.writeError(CodeInvalidState, "Logging is disabled in this room, no history is kept.")
+		return
+	}
+
+	history := room.history(0)
+	i, _ := slices.BinarySearchFunc(history, after, func(msg Message, seq uint64) int {
+		return cmp.Compare(msg.Seq, seq+1)
+	})
+	missed := history[i:]
+	if len(missed) == 0 {
+		c.writeMessage([]byte(fmt.Sprintf("📭 No messages after sequence number %d in %s.\n", after, room.name)))
+		return
+	}
+
+	if first := missed[0].Seq; first > after+1 {
+		c.writeMessage([]byte(fmt.Sprintf("⚠️ Messages %d to %d are no longer kept, replaying from %d.\n", after+1, first-1, first)))
+	}
+	if err := c.writeMessage([]byte(fmt.Sprintf("⏪ %d messages after sequence number %d in %s:\n", len(missed), after, room.name))); err != nil {
+		return
+	}
+	writeHistory(c, missed)
+}
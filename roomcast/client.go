@@ -0,0 +1,779 @@
+package roomcast
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const messageBufferSize = 256
+
+// urgentBufferSize bounds the high-priority queue of a client, which
+// holds private messages, notifications and mentions.
+const urgentBufferSize = 64
+
+// maxWriteTimeouts is the number of consecutive write timeouts
+// tolerated before a client is considered gone.
+const maxWriteTimeouts = 3
+
+var errRoomFull = errors.New("room is full")
+
+// errExpelled ends the writer of a client once it has been told it was
+// kicked or banned from a room.
+var errExpelled = errors.New("expelled from the room")
+
+// errRoomClosed is returned when the room stopped before it could do
+// what was asked.
+var errRoomClosed = errors.New("room is closed")
+
+// errTooManyRooms is returned when a user has created as many rooms as
+// Config.MaxRoomsPerUser allows.
+var errTooManyRooms = errors.New("you already created as many rooms as allowed, join an existing one")
+
+// errBanned is returned when the client's address is banned from the room.
+var errBanned = errors.New("you are banned from this room")
+
+// errNameTaken is returned when a member of the room already has the
+// client's username.
+var errNameTaken = errors.New("username already taken in this room")
+
+// errJoinThrottled is returned when a room admits members too fast.
+var errJoinThrottled = errors.New("room is admitting members slowly, try again")
+
+// Client represents a single chatting user
+type Client struct {
+	// The name of the client
+	username string
+
+	// conn is the connection for this client, over TCP or WebSocket.
+	conn net.Conn
+
+	// out writes the client's output to conn in the form its transport
+	// expects.
+	out transport
+
+	// reader reads the client's input from conn. It is the reader used
+	// during setup, so input the client typed ahead isn't lost.
+	reader *bufio.Reader
+
+	// send is a channel on which messages are sent.
+	send chan []byte
+
+	// urgent carries private messages, notifications and mentions. The
+	// write goroutine drains it before send, so they aren't stuck behind
+	// chat when the client falls behind.
+	urgent chan []byte
+
+	// server is the server this client is connected to, used to
+	// find or create the rooms the client joins.
+	server *Server
+
+	// room is the room the client is currently focused on.
+	// Messages typed by the client are forwarded to this room.
+	room *Room
+
+	// rooms holds every room the client has joined.
+	rooms map[*Room]struct{}
+
+	// joined receives the outcome of a join request from a room.
+	joined chan error
+
+	// redraw asks the write goroutine to draw the prompt again.
+	redraw chan struct{}
+
+	// Prompt format for the client
+	prompt string
+
+	// echo makes the client receive its own messages back.
+	echo bool
+
+	// pasting is set while the client is typing a /paste block,
+	// whose lines are collected in paste. Both are only changed by the
+	// read goroutine, pasting under mu since it also changes the prompt.
+	pasting bool
+	paste   []string
+
+	// quitting is set by /quit to end the read loop. It is only used
+	// by the read goroutine.
+	quitting bool
+
+	// paused is set while the client doesn't want to receive messages.
+	// Messages arriving meanwhile are kept in held, oldest first, and
+	// heldDropped counts those that didn't fit.
+	paused      bool
+	held        [][]byte
+	heldDropped int
+
+	// watches holds the lowercased keywords the client is alerted about,
+	// and bell makes alerts ring the terminal bell.
+	watches []string
+	bell    bool
+
+	// status is a short text the client shows next to its name.
+	status string
+
+	// lastReceived is the JSON of the last message delivered to the
+	// client, shown by /raw.
+	lastReceived []byte
+
+	// lastActivity is when the client last sent a message.
+	lastActivity time.Time
+
+	// lastSeen is when the client last sent anything, commands and
+	// empty lines included, in Unix nanoseconds. It answers heartbeats.
+	lastSeen atomic.Int64
+
+	// caps are the capabilities the client negotiated at connect time.
+	// Its conn tailors everything written to it accordingly.
+	caps capabilities
+
+	// lastDrained is when write last took a message off the client's
+	// queues, in Unix nanoseconds. Rooms use it to spot stuck writers.
+	lastDrained atomic.Int64
+
+	// mutedUntil is when the client's current flood cooldown ends.
+	mutedUntil time.Time
+
+	// admin reports whether the client has unlocked admin commands.
+	admin bool
+
+	// limiter throttles the messages sent by the client, and
+	// byteLimiter the bytes.
+	limiter     *rateLimiter
+	byteLimiter *byteLimiter
+
+	// closed is set once the send channel has been closed.
+	closed bool
+
+	// mu guards username, room, rooms, prompt, pasting, echo, the paused state, watches,
+	// bell, status, lastReceived, lastActivity, mutedUntil, admin and closed, which are
+	// changed and read from several goroutines.
+	mu sync.Mutex
+
+	// writeMu serializes writes to conn, which come from the write
+	// goroutine, the read goroutine's command replies and the rooms.
+	// It is only held while writing, never together with mu.
+	writeMu sync.Mutex
+
+	// closeOnce makes sure the connection and send channel are
+	// released exactly once, however many rooms the client was in.
+	closeOnce sync.Once
+
+	// done is closed once the client is disconnected.
+	done chan struct{}
+}
+
+// transport writes a client's output. Terminal clients get colored text
+// followed by the prompt, while WebSocket clients get JSON messages.
+type transport interface {
+	// writeText writes text from the server, such as a command reply.
+	writeText(text []byte) error
+
+	// writeMessage writes a message from a room, rendered being the
+	// text shown to terminal clients.
+	writeMessage(msg Message, rendered []byte) error
+
+	// writePrompt draws the prompt.
+	writePrompt(prompt string) error
+}
+
+// textTransport writes output as is, for terminal clients.
+type textTransport struct {
+	conn net.Conn
+}
+
+func (t textTransport) writeText(text []byte) error {
+	_, err := t.conn.Write(text)
+	return err
+}
+
+func (t textTransport) writeMessage(msg Message, rendered []byte) error {
+	return t.writeText(rendered)
+}
+
+func (t textTransport) writePrompt(prompt string) error {
+	return t.writeText([]byte(prompt))
+}
+
+// textNotification turns text from the server into a Notification
+// message for clients that receive JSON, without the colors meant for
+// terminals. It reports false for blank text.
+func textNotification(text []byte) (Message, bool) {
+	content := strings.TrimSpace(stripColors(string(text)))
+	if content == "" {
+		return Message{}, false
+	}
+	return NewMessage(content, "", NotificationType), true
+}
+
+// newClient creates a client on conn. Connections implementing
+// transport, such as WebSocket ones, choose how output is written;
+// others get plain text.
+func newClient(conn net.Conn, reader *bufio.Reader, username string, server *Server) *Client {
+	out, ok := conn.(transport)
+	if !ok {
+		out = textTransport{conn}
+	}
+	c := &Client{
+		conn:         conn,
+		out:          out,
+		reader:       reader,
+		send:         make(chan []byte, messageBufferSize),
+		urgent:       make(chan []byte, urgentBufferSize),
+		server:       server,
+		rooms:        make(map[*Room]struct{}),
+		joined:       make(chan error, 1),
+		redraw:       make(chan struct{}, 1),
+		limiter:      newRateLimiter(server.cfg),
+		byteLimiter:  newByteLimiter(server.cfg),
+		username:     username,
+		caps:         capabilitiesOf(conn),
+		lastActivity: time.Now(),
+		done:         make(chan struct{}),
+	}
+	c.seen()
+	c.drained()
+	return c
+}
+
+// read allows our client to read from the TCP conn,
+// continually sending any received messages to the
+// forward channel on the room type.
+// If it encounters an error, the loop will break and the conn will be closed.
+func (c *Client) read() {
+	for {
+		c.requestPrompt()
+		c.setIdleDeadline()
+
+		line, err := readLine(c.reader, c.caps.framing)
+		if err == nil || isFrameError(err) {
+			c.seen()
+		}
+		if isFrameError(err) {
+			code := CodeUsage
+			if errors.Is(err, errFrameTooLarge) {
+				code = CodeTooLarge
+			}
+			c.writeError(code, fmt.Sprintf("Message rejected: %v.", err))
+			continue
+		}
+		if isTimeout(err) && c.server.cfg.IdleTimeout > 0 {
+			c.timeOut()
+			break
+		}
+		if err != nil {
+			slog.Debug("🚨 Read error", "user", c.name(), "err", err)
+			break
+		}
+
+		msg := bytes.TrimSpace(line)
+		if len(msg) == 0 && !c.pasting {
+			continue
+		}
+
+		if c.pasting {
+			if !c.pasteLine(string(line)) {
+				return
+			}
+			continue
+		}
+
+		content := string(msg)
+		if strings.HasPrefix(content, "//") {
+			// "//text" sends "/text" as a regular message
+			content = content[1:]
+		} else if strings.HasPrefix(content, "/") {
+			c.runCommand(content)
+			if c.quitting {
+				break
+			}
+			continue
+		}
+
+		message := NewMessage(content, c.name(), UserMessageType)
+		if room, text, ok := c.roomTag(content); ok {
+			message.Content, message.Room = text, room.name
+		}
+		if pasted := c.pastedLines(); len(pasted) > 0 {
+			message.Content = strings.Join(append([]string{message.Content}, pasted...), "\n")
+			message.Type = PasteMessageType
+		}
+		if !c.postMessage(message) {
+			return
+		}
+	}
+
+	c.close()
+}
+
+// requestPrompt asks the write goroutine to redraw the prompt. Only
+// the write goroutine draws the prompt, after every message it
+// delivers and whenever it is requested, so it always ends up last on
+// the client's screen and is never drawn twice in a row by two writers.
+func (c *Client) requestPrompt() {
+	select {
+	case c.redraw <- struct{}{}:
+	default:
+		// A redraw is already pending.
+	}
+}
+
+// post forwards content typed by the client to its current room once
+// it passes the rate limit. It returns false if the client has been
+// disconnected for flooding or the room has stopped.
+func (c *Client) post(content, msgType string) bool {
+	return c.postMessage(NewMessage(content, c.name(), msgType))
+}
+
+// postMessage is post for a message built by the caller. When
+// message.Room names one of the joined rooms, the message goes there
+// instead of the current room.
+func (c *Client) postMessage(message Message) bool {
+	room := c.currentRoom()
+	if joined := c.joinedRoom(message.Room); joined != nil {
+		room = joined
+	}
+	if room.frozen.Load() && !c.isAdmin() {
+		c.writeError(CodeForbidden, fmt.Sprintf("%s is frozen, only admins can post for now.", room.name))
+		return true
+	}
+
+	content := message.Content
+	now := time.Now()
+	if !c.byteLimiter.fits(now, len(content)) {
+		if len(content) > c.byteLimiter.budget() {
+			c.writeError(CodeTooLarge, fmt.Sprintf("Message too large, at most %d bytes can be sent over %v.", c.byteLimiter.budget(), c.byteLimiter.window))
+		} else {
+			c.writeError(CodeRateLimited, "You are sending too much text, wait a moment before sending more.")
+		}
+		return true
+	}
+
+	switch c.limiter.check(now) {
+	case rateWarned:
+		c.writeError(CodeRateLimited, "You are sending messages too fast, slow down or you will be muted.")
+		return true
+	case rateCooldown:
+		c.mu.Lock()
+		c.mutedUntil = c.limiter.cooldownUntil
+		c.mu.Unlock()
+		c.writeError(CodeRateLimited, fmt.Sprintf("You are muted for flooding, try again in %v.", c.limiter.cooldownLeft(now)))
+		return true
+	case rateMuted:
+		return true
+	case rateKicked:
+		slog.Warn("🚨 Kicked for flooding", "user", c.name())
+		c.writeError(CodeKicked, "You have been disconnected for flooding.")
+		c.close()
+		return false
+	}
+
+	c.byteLimiter.record(now, len(content))
+
+	c.mu.Lock()
+	c.lastActivity = now
+	c.mu.Unlock()
+
+	message.Room = room.name
+
+	select {
+	case room.forward <- message.ToJSON():
+		return true
+	case <-room.ctx.Done():
+		// The room disconnects its members when it stops.
+		return false
+	}
+}
+
+// write continually accepts messages from the send channel,
+// it write everything out of the conn, followed by the prompt.
+// It also redraws the prompt when asked by requestPrompt.
+// A write that times out is skipped, since the client may only be
+// briefly slow, but after maxWriteTimeouts in a row or on any other
+// error the conn is closed and the loop ends.
+func (c *Client) write() {
+	timeouts := 0
+	for {
+		var err error
+		select {
+		case rawMessage := <-c.urgent:
+			c.drained()
+			err = c.render(rawMessage)
+		default:
+			select {
+			case rawMessage := <-c.urgent:
+				c.drained()
+				err = c.render(rawMessage)
+			case rawMessage, ok := <-c.send:
+				if !ok {
+					return
+				}
+				c.drained()
+				err = c.render(rawMessage)
+			case <-c.redraw:
+				err = c.writePrompt()
+			}
+		}
+
+		switch {
+		case err == nil:
+			timeouts = 0
+		case errors.Is(err, errExpelled):
+			c.conn.Close()
+			return
+		case isTimeout(err) && timeouts < maxWriteTimeouts:
+			timeouts++
+			slog.Warn("⏳ Write timed out, skipping message", "user", c.name(), "err", err)
+		default:
+			slog.Debug("🚨 Write error", "user", c.name(), "err", err)
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+// render formats a message received from a room and writes it to the
+// client followed by the prompt, unless it is filtered out or held.
+func (c *Client) render(rawMessage []byte) error {
+	msg, err := FromJSON(rawMessage)
+	if err != nil {
+		slog.Error("❌ Failed to parse message", "user", c.name(), "err", err)
+		return nil
+	}
+	if msg.Type == ErrorType && msg.Code == CodeKicked {
+		// Sent by Room.expel: shown even when paused, and the last
+		// thing the client gets.
+		c.writeRoomMessage(msg, c.server.style.layout(msg.format(c.server.style), true))
+		return errExpelled
+	}
+	if msg.Type != NotificationType && msg.Sender == c.name() && !c.echoEnabled() {
+		return nil
+	}
+	c.received(rawMessage)
+
+	text := msg.format(c.server.style)
+	if prefix := c.roomPrefix(msg.Room); prefix != "" {
+		text = prefix + " " + text
+	}
+	if msg.Type != NotificationType && msg.Type != DeleteType {
+		if keyword := c.watchedKeyword(msg.Content); keyword != "" {
+			text = fmt.Sprintf("%s👀 [%s]%s %s", ColorHighlight, keyword, ColorReset, text)
+			if c.bellEnabled() {
+				text = "\a" + text
+			}
+		}
+	}
+	out := c.server.style.layout(text, msg.Type != ErrorType)
+
+	if c.hold(out) {
+		return nil
+	}
+
+	if err := c.writeRoomMessage(msg, out); err != nil {
+		return err
+	}
+	return c.writePrompt()
+}
+
+// writeRoomMessage writes a message from a room to the client, rendered
+// being the text shown to terminal clients.
+func (c *Client) writeRoomMessage(msg Message, rendered []byte) error {
+	return c.writeOut(func() error { return c.out.writeMessage(msg, rendered) })
+}
+
+// writeMessage writes text from the server, such as a command reply,
+// to the client.
+func (c *Client) writeMessage(msg []byte) error {
+	return c.writeOut(func() error { return c.out.writeText(msg) })
+}
+
+// writePrompt draws the client's prompt.
+func (c *Client) writePrompt() error {
+	prompt := c.currentPrompt()
+	return c.writeOut(func() error { return c.out.writePrompt(prompt) })
+}
+
+// writeOut runs write, which writes to the client's connection, once
+// the writes already in progress are done, so that the output of two
+// goroutines never interleaves. Each write is bounded by
+// Config.WriteTimeout.
+func (c *Client) writeOut(write func() error) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.setWriteDeadline()
+	return write()
+}
+
+// setWriteDeadline bounds the next write to the client by
+// Config.WriteTimeout.
+func (c *Client) setWriteDeadline() {
+	if timeout := c.server.cfg.WriteTimeout; timeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	}
+}
+
+// isTimeout reports whether err is a transient timeout rather than
+// a sign that the client is gone.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// joinRoom asks the room to admit the client and waits for its answer.
+// On success the room is added to the client's rooms and becomes the
+// current one.
+func (c *Client) joinRoom(room *Room) error {
+	select {
+	case room.join <- c:
+	case <-room.ctx.Done():
+		return fmt.Errorf("room %s is shutting down", room.name)
+	}
+
+	if err := <-c.joined; err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.rooms[room] = struct{}{}
+	c.mu.Unlock()
+	c.switchRoom(room)
+
+	c.server.rememberRoom(remoteIP(c.conn), c.name(), room.name)
+	c.server.emit(Event{Type: EventClientJoined, Room: room.name, Username: c.name()})
+
+	return nil
+}
+
+// leaveRoom removes the client from room, which tells its other
+// members. The client must have switched to another room first.
+func (c *Client) leaveRoom(room *Room) {
+	c.mu.Lock()
+	delete(c.rooms, room)
+	c.mu.Unlock()
+
+	select {
+	case room.leave <- c:
+	case <-room.ctx.Done():
+	}
+}
+
+// switchRoom makes room the client's current room and updates the prompt.
+func (c *Client) switchRoom(room *Room) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.room = room
+	c.prompt = fmt.Sprintf("%s%s 🏠 %s%s > ", room.color, c.server.displayName(c.username), c.server.displayName(room.name), ColorReset)
+}
+
+// joinedRoom returns the joined room with the given name, or nil.
+func (c *Client) joinedRoom(name string) *Room {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for room := range c.rooms {
+		if room.name == name {
+			return room
+		}
+	}
+	return nil
+}
+
+// name returns the client's username, which /nick may change.
+func (c *Client) name() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.username
+}
+
+// joinedRooms returns every room the client has joined.
+func (c *Client) joinedRooms() []*Room {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rooms := make([]*Room, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+func (c *Client) currentRoom() *Room {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.room
+}
+
+func (c *Client) currentPrompt() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.pasting {
+		return pastePrompt
+	}
+	return c.prompt
+}
+
+// roomPrefix returns the colored room tag shown in front of messages
+// when the client is in more than one room, or "" otherwise.
+func (c *Client) roomPrefix(name string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.rooms) < 2 {
+		return ""
+	}
+	for room := range c.rooms {
+		if room.name == name {
+			return fmt.Sprintf("%s[%s]%s", room.color, c.server.displayName(room.name), ColorReset)
+		}
+	}
+	return ""
+}
+
+// roomTag splits "#room text" into the joined room it names and the
+// text to post there, without switching rooms. ok is false unless
+// content starts with the tag of a joined room, so other #hashtags are
+// sent as they are.
+func (c *Client) roomTag(content string) (*Room, string, bool) {
+	tag, text, _ := strings.Cut(content, " ")
+	name, found := strings.CutPrefix(tag, "#")
+	text = strings.TrimSpace(text)
+	if !found || text == "" {
+		return nil, "", false
+	}
+	room := c.joinedRoom(strings.ToUpper(name))
+	if room == nil {
+		return nil, "", false
+	}
+	return room, text, true
+}
+
+func (c *Client) echoEnabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.echo
+}
+
+// idleFor returns how long ago the client last sent a message.
+func (c *Client) idleFor() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Since(c.lastActivity)
+}
+
+func (c *Client) bellEnabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bell
+}
+
+func (c *Client) isAdmin() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.admin
+}
+
+// queueFor returns the queue msg goes through to reach the client:
+// urgent for private messages, whispers, notifications and messages mentioning
+// the client, send for the rest.
+func (c *Client) queueFor(msg *Message) chan []byte {
+	switch msg.Type {
+	case PrivateMessageType, WhisperMessageType, NotificationType:
+		return c.urgent
+	}
+	if mentions(msg.Content, c.name()) {
+		return c.urgent
+	}
+	return c.send
+}
+
+// mentions reports whether content contains "@username" as a whole
+// word, ignoring case.
+func mentions(content, username string) bool {
+	content, tag := strings.ToLower(content), "@"+strings.ToLower(username)
+	for {
+		i := strings.Index(content, tag)
+		if i < 0 {
+			return false
+		}
+		content = content[i+len(tag):]
+		if next, _ := utf8.DecodeRuneInString(content); !unicode.IsLetter(next) && !unicode.IsDigit(next) && next != '_' {
+			return true
+		}
+	}
+}
+
+// deliver queues a message for the client from outside its rooms,
+// e.g. a private notice. It reports false if the client is gone or
+// can't keep up.
+func (c *Client) deliver(msg Message) bool {
+	queued, _ := c.enqueue(c.queueFor(&msg), msg.ToJSON())
+	return queued
+}
+
+// enqueue puts data on queue without blocking. closed is checked under
+// mu, so nothing is sent on the send channel once disconnect has closed
+// it, even by a room that hasn't seen the client leave yet. It reports
+// whether data was queued and whether the client is disconnected.
+func (c *Client) enqueue(queue chan []byte, data []byte) (queued, closed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false, true
+	}
+
+	select {
+	case queue <- data:
+		return true, false
+	default:
+		return false, false
+	}
+}
+
+func (c *Client) close() {
+	// Notify every joined room that this client is leaving
+	c.mu.Lock()
+	rooms := make([]*Room, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	c.rooms = make(map[*Room]struct{})
+	c.mu.Unlock()
+
+	for _, room := range rooms {
+		select {
+		case room.leave <- c:
+		case <-room.ctx.Done():
+		}
+	}
+
+	c.server.removeClient(c)
+	c.disconnect()
+	c.server.emit(Event{Type: EventClientDisconnected, Username: c.name(), RemoteAddr: c.conn.RemoteAddr().String()})
+}
+
+// disconnect closes the connection and the send channel exactly once.
+// A room still sending to the client afterwards, such as one stopping
+// before it took the leave, is refused by enqueue.
+func (c *Client) disconnect() {
+	c.closeOnce.Do(func() {
+		c.conn.Close()
+
+		c.mu.Lock()
+		c.closed = true
+		close(c.send)
+		c.mu.Unlock()
+		close(c.done)
+	})
+}
@@ -0,0 +1,213 @@
+package roomcast
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// overlapConn counts the writes that started while another one was
+// still in progress.
+type overlapConn struct {
+	net.Conn
+	writing  atomic.Int32
+	overlaps atomic.Int32
+}
+
+func (c *overlapConn) Write(p []byte) (int, error) {
+	if c.writing.Add(1) > 1 {
+		c.overlaps.Add(1)
+	}
+	defer c.writing.Add(-1)
+	time.Sleep(50 * time.Microsecond)
+	return c.Conn.Write(p)
+}
+
+func TestClientWritesDontOverlap(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(c *Client)
+	}{
+		{name: "prompt", write: func(c *Client) { c.writePrompt() }},
+		{name: "command reply", write: func(c *Client) { c.writeMessage([]byte("reply\n")) }},
+		{name: "history", write: func(c *Client) { c.currentRoom().sendHistory(c) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			conn := &overlapConn{}
+			alice := pipe(t, server, func(c net.Conn) net.Conn {
+				conn.Conn = c
+				return conn
+			})
+			alice.expect("Enter username: ")
+			alice.send("alice")
+			alice.expect("Enter room name: ")
+			alice.send("room_one")
+			alice.expect(" > ")
+			go io.Copy(io.Discard, alice.conn)
+
+			client := clientNamed(t, server, "alice")
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for range 50 {
+					client.deliver(NewMessage("hello", "bobby", UserMessageType))
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for range 50 {
+					tt.write(client)
+				}
+			}()
+			wg.Wait()
+
+			if n := conn.overlaps.Load(); n > 0 {
+				t.Errorf("%d writes overlapped", n)
+			}
+		})
+	}
+}
+
+func TestClientCleanupRace(t *testing.T) {
+	const slowClients = 5
+
+	tests := []struct {
+		name string
+		run  func(flood, hangUp func())
+	}{
+		{name: "read error first", run: func(flood, hangUp func()) { hangUp(); flood() }},
+		{name: "removed by the room first", run: func(flood, hangUp func()) { flood(); hangUp() }},
+		{
+			name: "both at once",
+			run: func(flood, hangUp func()) {
+				var wg sync.WaitGroup
+				wg.Add(2)
+				go func() { defer wg.Done(); flood() }()
+				go func() { defer wg.Done(); hangUp() }()
+				wg.Wait()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			var clients []*testClient
+			for i := range slowClients {
+				c := pipe(t, server, func(conn net.Conn) net.Conn { return conn })
+				c.setup(fmt.Sprintf("slow%d", i), "room_one")
+				clients = append(clients, c)
+			}
+			room := server.Room("ROOM_ONE")
+
+			// The slow clients never read again, so flooding the room
+			// fills their queues and the room removes them, while
+			// hanging up makes their read loops fail and close them.
+			flood := func() {
+				for i := range messageBufferSize + 2 {
+					room.forward <- NewMessage(fmt.Sprintf("message %d", i), "alice", UserMessageType).ToJSON()
+				}
+			}
+			hangUp := func() {
+				for _, c := range clients {
+					c.conn.Close()
+				}
+			}
+			tt.run(flood, hangUp)
+
+			waitFor(t, "the slow clients to be removed", func() bool {
+				return server.Stats().Clients == 0 && room.memberCount.Load() == 0
+			})
+
+			alice := join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_one")
+			alice.send("still here")
+			bobby.expect("💬 still here")
+		})
+	}
+}
+
+func TestSendAfterDisconnect(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{name: "send queue", msg: NewMessage("hello", "carol", UserMessageType)},
+		{name: "urgent queue", msg: NewMessage("hello @alice", "carol", UserMessageType)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_one")
+			alice := clientNamed(t, server, "alice")
+			room := server.Room("ROOM_ONE")
+
+			// alice is disconnected, e.g. by a shutdown, while the room
+			// still has alice as a member.
+			room.do(func() {
+				alice.disconnect()
+				room.broadcast(&tt.msg, nil)
+			})
+			bobby.expect("💬 " + tt.msg.Content)
+			waitFor(t, "alice to leave", func() bool { return !room.HasClient("alice") })
+		})
+	}
+}
+
+func TestPostToStoppedRoom(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(t *testing.T, server *Server, room *Room)
+		want bool
+	}{
+		{name: "running room", stop: func(t *testing.T, server *Server, room *Room) {}, want: true},
+		{
+			name: "stopped room",
+			stop: func(t *testing.T, server *Server, room *Room) {
+				room.stop()
+				<-room.done
+			},
+		},
+		{
+			name: "server shut down",
+			stop: func(t *testing.T, server *Server, room *Room) {
+				ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+				defer cancel()
+				if err := server.Shutdown(ctx); err != nil {
+					t.Fatalf("Shutdown: %v", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_one")
+			alice := clientNamed(t, server, "alice")
+			tt.stop(t, server, server.Room("ROOM_ONE"))
+
+			posted := make(chan bool, 1)
+			go func() { posted <- alice.postMessage(NewMessage("hello", "alice", UserMessageType)) }()
+			select {
+			case got := <-posted:
+				if got != tt.want {
+					t.Errorf("postMessage = %v, want %v", got, tt.want)
+				}
+			case <-time.After(testTimeout):
+				t.Fatal("postMessage blocked")
+			}
+			if tt.want {
+				bobby.expect("💬 hello")
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package roomcast
+
+import (
+	"math/rand"
+	"regexp"
+	"time"
+)
+
+const (
+	ColorReset           = "\033[0m"
+	ColorWhiteText       = "\033[1;97m"
+	ColorNotification    = "\033[5;92m"
+	ColorWhiteBackground = "\033[47m"
+	ColorLink            = "\033[4;94m"
+	ColorHighlight       = "\033[1;30;103m"
+	ColorError           = "\033[1;91m"
+)
+
+// ansiPattern matches the color escape sequences used by the server.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// stripColors removes color escape sequences from text.
+func stripColors(text string) string {
+	return ansiPattern.ReplaceAllString(text, "")
+}
+
+var random *rand.Rand
+
+func init() {
+	// Seed the random number generator once at startup
+	random = rand.New(rand.NewSource(time.Now().UnixNano()))
+}
+
+// roomColors is the palette room names are displayed with.
+var roomColors = []string{
+	"\033[0;104m",
+	"\033[0;105m",
+	"\033[0;106m",
+	"\033[1;100m",
+	"\033[1;103m",
+	"\033[1;41m",
+	"\033[1;42m",
+}
+
+// getRandomColor picks a random room color among the least used ones,
+// so that rooms get distinct colors until the palette is exhausted.
+// used counts the rooms using each color.
+func getRandomColor(used map[string]int) string {
+	var least []string
+	for _, color := range roomColors {
+		switch {
+		case len(least) == 0 || used[color] < used[least[0]]:
+			least = []string{color}
+		case used[color] == used[least[0]]:
+			least = append(least, color)
+		}
+	}
+
+	return least[random.Intn(len(least))]
+}
@@ -0,0 +1,261 @@
+package roomcast
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// commandHandler handles a slash command typed by a client.
+// args holds the words that followed the command name.
+type commandHandler func(c *Client, args []string)
+
+// permission is what a client needs to run a command.
+type permission int
+
+const (
+	// permAnyone lets every client run the command.
+	permAnyone permission = iota
+	// permAdmin reserves the command to admins.
+	permAdmin
+)
+
+// command is a slash command and the permission it requires.
+type command struct {
+	handler    commandHandler
+	permission permission
+}
+
+// commands maps a command name (without the leading slash) to the command.
+var commands = map[string]command{}
+
+func init() {
+	registerCommand("join", joinCommand)
+	registerCommand("switch", switchCommand)
+	registerCommand("help", helpCommand)
+	registerCommand("who", whoCommand)
+	registerCommand("list", listCommand)
+	registerCommand("quit", quitCommand)
+	registerCommand("prompt", promptCommand)
+}
+
+// registerCommand makes a command available to every client.
+func registerCommand(name string, handler commandHandler) {
+	commands[name] = command{handler: handler, permission: permAnyone}
+}
+
+// registerAdminCommand makes a command available to admins only.
+func registerAdminCommand(name string, handler commandHandler) {
+	commands[name] = command{handler: handler, permission: permAdmin}
+}
+
+// allows reports whether the client may run cmd.
+func (cmd command) allows(c *Client) bool {
+	return cmd.permission == permAnyone || c.isAdmin()
+}
+
+// parseCommand splits a line starting with "/" into the command name
+// and its arguments. It returns an empty name for regular messages.
+func parseCommand(line string) (string, []string) {
+	if !strings.HasPrefix(line, "/") {
+		return "", nil
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(line, "/"))
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	return strings.ToLower(fields[0]), fields[1:]
+}
+
+// runCommand runs the command typed by the client if it has the
+// required permission. Unknown commands are answered to the sender
+// only, so that mistyped commands never reach the room or its history.
+func (c *Client) runCommand(line string) {
+	name, args := parseCommand(line)
+	cmd, ok := commands[name]
+	if !ok {
+		typed := strings.Fields(line)[0]
+		c.writeError(CodeUnknownCommand, fmt.Sprintf("unknown command: %s, try /help (start with // to send a message beginning with /).", typed))
+		return
+	}
+	if cmd.permission == permAdmin && !requireAdmin(c) {
+		return
+	}
+	cmd.handler(c, args)
+}
+
+// helpCommand handles "/help": it lists the commands the client is
+// allowed to run, so admin commands are only shown to admins.
+func helpCommand(c *Client, args []string) {
+	names := make([]string, 0, len(commands))
+	for name, cmd := range commands {
+		if cmd.allows(c) {
+			names = append(names, "/"+name)
+		}
+	}
+	sort.Strings(names)
+
+	c.writeMessage([]byte(fmt.Sprintf("📖 Commands: %s\n", strings.Join(names, " "))))
+}
+
+// promptCommand handles "/prompt", for users whose prompt scrolled
+// away. The read loop draws the prompt again before reading the next
+// line, so there is nothing else to do, and only the client sees it.
+func promptCommand(c *Client, args []string) {}
+
+// joinCommand handles "/join <room> [password]": it joins another room
+// while staying in the current ones, and makes it the current room.
+// The password is only needed for locked rooms.
+func joinCommand(c *Client, args []string) {
+	if len(args) < 1 || len(args) > 2 || !c.server.isValidRoomName(args[0]) {
+		c.writeError(CodeUsage, fmt.Sprintf("Usage: /join <room> [password] (%s).", c.server.roomNameRules()))
+		return
+	}
+	name := strings.ToUpper(args[0])
+
+	if room := c.joinedRoom(name); room != nil {
+		c.switchRoom(room)
+		c.writeMessage([]byte(fmt.Sprintf("🏠 You are already in %s, switched to it.\n", name)))
+		return
+	}
+
+	c.enterRoom(name, passwordArg(args))
+}
+
+// switchCommand handles "/switch <room> [password]": it changes the
+// current room to one the client has already joined, or else moves the
+// client to the room, leaving the current one.
+func switchCommand(c *Client, args []string) {
+	if len(args) < 1 || len(args) > 2 || !c.server.isValidRoomName(args[0]) {
+		c.writeError(CodeUsage, fmt.Sprintf("Usage: /switch <room> [password] (%s).", c.server.roomNameRules()))
+		return
+	}
+	name := strings.ToUpper(args[0])
+
+	if room := c.joinedRoom(name); room != nil {
+		c.switchRoom(room)
+		return
+	}
+
+	// Join first, so the client keeps its room if the new one refuses it
+	previous := c.currentRoom()
+	if c.enterRoom(name, passwordArg(args)) {
+		c.leaveRoom(previous)
+	}
+}
+
+// enterRoom joins the room with the given name, creating it if needed,
+// and sends its history, topic and message of the day. It tells the
+// client and returns false if the room refuses it or is locked with
+// another password.
+func (c *Client) enterRoom(name, password string) bool {
+	room, err := c.server.getOrCreateRoom(name, c.name())
+	if err != nil {
+		c.writeError(CodeLimitReached, fmt.Sprintf("Cannot create %s: %v.", name, err))
+		return false
+	}
+	if err := c.server.tryPassword(room, remoteIP(c.conn), password); err != nil {
+		switch {
+		case errors.Is(err, errTooManyPasswords):
+			c.writeError(CodeWrongPassword, fmt.Sprintf("Too many wrong passwords for %s, try again later.", name))
+		case password == "":
+			c.writeError(CodeWrongPassword, fmt.Sprintf("%s is locked, use /join %s <password>.", name, name))
+		default:
+			c.writeError(CodeWrongPassword, fmt.Sprintf("Wrong password for %s.", name))
+		}
+		return false
+	}
+	if err := c.joinRoom(room); err != nil {
+		c.writeError(joinErrorCode(err), fmt.Sprintf("Cannot join %s: %v.", name, err))
+		return false
+	}
+
+	room.sendHistory(c)
+	room.sendTopic(c)
+	room.sendMotd(c)
+	return true
+}
+
+// passwordArg returns the optional password following the room name
+// of /join and /switch.
+func passwordArg(args []string) string {
+	if len(args) < 2 {
+		return ""
+	}
+	return args[1]
+}
+
+// whoCommand handles "/who": it lists the members of the current room,
+// with their status if they have one.
+func whoCommand(c *Client, args []string) {
+	room := c.currentRoom()
+	members := room.members()
+
+	var b strings.Builder
+	if len(members) == 1 {
+		fmt.Fprintf(&b, "👥 1 user online in %s, just you:\n", room.name)
+	} else {
+		fmt.Fprintf(&b, "👥 %d users online in %s:\n", len(members), room.name)
+	}
+	for _, member := range members {
+		fmt.Fprintf(&b, "  - %s\n", member.label())
+	}
+	c.writeMessage([]byte(b.String()))
+}
+
+// listCommand handles "/list": it lists the rooms with their number
+// of members, sorted by name.
+func listCommand(c *Client, args []string) {
+	s := c.server
+	s.mu.RLock()
+	rooms := make([]*Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		rooms = append(rooms, room)
+	}
+	s.mu.RUnlock()
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].name < rooms[j].name })
+
+	current := c.currentRoom()
+	if len(rooms) == 1 && rooms[0] == current {
+		c.writeMessage([]byte("📭 No other rooms yet.\n"))
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "🏠 %d rooms:\n", len(rooms))
+	for _, room := range rooms {
+		fmt.Fprintf(&b, "  %s  %s %s (%d online)", room.color, ColorReset, c.server.displayName(room.name), room.memberCount.Load())
+		if room.isLocked() {
+			b.WriteString(" 🔒")
+		}
+		if room == current {
+			b.WriteString(" ← you are here")
+		}
+		b.WriteString("\n")
+	}
+	c.writeMessage([]byte(b.String()))
+}
+
+// quitCommand handles "/quit [message]": it says goodbye to the
+// joined rooms if a message is given, then ends the read loop, which
+// leaves the rooms and closes the connection.
+func quitCommand(c *Client, args []string) {
+	if goodbye := sanitizeText(strings.Join(args, " "), maxStatusLength); goodbye != "" {
+		for _, room := range c.joinedRooms() {
+			room.do(func() {
+				room.broadcast(&Message{
+					Content: fmt.Sprintf("👋 %s says goodbye: %s\n", c.name(), goodbye),
+					Sender:  c.name(),
+					Type:    NotificationType,
+					Room:    room.name,
+				}, c)
+			})
+		}
+	}
+
+	c.writeMessage([]byte("👋 Bye!\n"))
+	c.quitting = true
+}
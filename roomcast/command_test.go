@@ -0,0 +1,169 @@
+package roomcast
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		line     string
+		wantName string
+		wantArgs []string
+	}{
+		{line: "hello", wantName: ""},
+		{line: "/", wantName: ""},
+		{line: "/   ", wantName: ""},
+		{line: "/who", wantName: "who", wantArgs: []string{}},
+		{line: "/WHO", wantName: "who", wantArgs: []string{}},
+		{line: "/join  room_two   secret", wantName: "join", wantArgs: []string{"room_two", "secret"}},
+		{line: "say /who", wantName: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			name, args := parseCommand(tt.line)
+			if name != tt.wantName {
+				t.Errorf("name = %q, want %q", name, tt.wantName)
+			}
+			if tt.wantName != "" && !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("args = %q, want %q", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	registerCommand("ping", func(c *Client, args []string) {
+		c.writeMessage([]byte(fmt.Sprintf("pong %q\n", args)))
+	})
+	t.Cleanup(func() { delete(commands, "ping") })
+
+	tests := []struct {
+		name      string
+		line      string
+		reply     string
+		forwarded string
+	}{
+		{name: "unknown command", line: "/nosuch arg", reply: "unknown command: /nosuch"},
+		{name: "case insensitive", line: "/WHO", reply: "2 users online in ROOM_ONE"},
+		{name: "registered command", line: "/ping a b", reply: `pong ["a" "b"]`},
+		{name: "escaped slash", line: "//nosuch", forwarded: "💬 /nosuch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			alice := join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_one")
+			alice.expect("bobby has joined the room")
+
+			alice.send(tt.line)
+			if tt.reply != "" {
+				alice.expect(tt.reply)
+			}
+			if tt.forwarded != "" {
+				bobby.expect(tt.forwarded)
+				return
+			}
+
+			// Commands never reach the room: bobby gets the next
+			// message and nothing before it.
+			alice.send("done")
+			if out := bobby.expect("💬 done"); strings.Contains(out, tt.line[1:]) {
+				t.Errorf("command forwarded to the room: %q", out)
+			}
+		})
+	}
+}
+
+func TestQuit(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		goodbye string
+		rooms   []string
+	}{
+		{name: "no message", line: "/quit", rooms: []string{"ROOM_ONE"}},
+		{name: "goodbye message", line: "/quit see you", goodbye: "alice says goodbye: see you", rooms: []string{"ROOM_ONE"}},
+		{name: "two rooms", line: "/quit", rooms: []string{"ROOM_ONE", "ROOM_TWO"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			alice := join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_one")
+			alice.expect("bobby has joined the room")
+			for _, room := range tt.rooms[1:] {
+				alice.send("/join " + room)
+				alice.expect(room + ColorReset + " > ")
+				bobby.send("/join " + room)
+				alice.expect("bobby has joined the room")
+			}
+			client := clientNamed(t, server, "alice")
+			for len(server.Events()) > 0 {
+				<-server.Events()
+			}
+
+			alice.send(tt.line)
+			alice.expect("Bye!")
+			alice.expectClosed()
+			if tt.goodbye != "" {
+				bobby.expect(tt.goodbye)
+			}
+
+			// Collect events until alice is gone, and a while longer
+			// to catch duplicates.
+			left := map[string]int{}
+			disconnected := 0
+			timeout := time.After(testTimeout)
+			for settle := (<-chan time.Time)(nil); ; {
+				select {
+				case event := <-server.Events():
+					if event.Username != "alice" {
+						continue
+					}
+					switch event.Type {
+					case EventClientLeft:
+						left[event.Room]++
+					case EventClientDisconnected:
+						disconnected++
+						settle = time.After(200 * time.Millisecond)
+					}
+					continue
+				case <-settle:
+				case <-timeout:
+					t.Fatal("alice never disconnected")
+				}
+				break
+			}
+
+			if disconnected != 1 {
+				t.Errorf("alice disconnected %d times, want once", disconnected)
+			}
+			for _, name := range tt.rooms {
+				if left[name] != 1 {
+					t.Errorf("alice left %s %d times, want once", name, left[name])
+				}
+				server.mu.RLock()
+				room := server.rooms[name]
+				server.mu.RUnlock()
+				if n := room.ClientCount(); n != 1 {
+					t.Errorf("%s has %d members, want 1", name, n)
+				}
+			}
+			select {
+			case <-client.done:
+			default:
+				t.Error("alice's client was not released")
+			}
+			client.mu.Lock()
+			closed := client.closed
+			client.mu.Unlock()
+			if !closed {
+				t.Error("alice's send channel is still open")
+			}
+		})
+	}
+}
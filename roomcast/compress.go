@@ -0,0 +1,82 @@
+package roomcast
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// compressCommand is the line a client sends instead of its username
+// to switch the connection to zlib compression.
+const compressCommand = "/compress zlib"
+
+// compressedConn wraps a connection so that everything read from and
+// written to it goes through a zlib stream in each direction. Every
+// write is flushed so messages are delivered without delay.
+type compressedConn struct {
+	net.Conn
+
+	// src is where compressed input is read from.
+	src io.Reader
+	r   io.ReadCloser
+
+	// mu serializes writes, which come from several goroutines.
+	mu sync.Mutex
+	w  *zlib.Writer
+}
+
+// newCompressedConn switches conn to compression. reader is the reader
+// used on conn so far: its buffered bytes are kept as the start of the
+// compressed input, and it is reset to read decompressed data.
+func newCompressedConn(conn net.Conn, reader *bufio.Reader) *compressedConn {
+	buffered, _ := reader.Peek(reader.Buffered())
+	cc := &compressedConn{
+		Conn: conn,
+		src:  io.MultiReader(bytes.NewReader(bytes.Clone(buffered)), conn),
+		w:    zlib.NewWriter(conn),
+	}
+	reader.Reset(cc)
+	return cc
+}
+
+// Read decompresses input from the client. The zlib reader is created
+// lazily since it blocks until the client sends the stream header.
+func (cc *compressedConn) Read(p []byte) (int, error) {
+	if cc.r == nil {
+		r, err := zlib.NewReader(cc.src)
+		if err != nil {
+			return 0, err
+		}
+		cc.r = r
+	}
+	return cc.r.Read(p)
+}
+
+// Write compresses p and flushes it to the client.
+func (cc *compressedConn) Write(p []byte) (int, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	n, err := cc.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, cc.w.Flush()
+}
+
+// Close ends the compressed stream and closes the connection. Rooms
+// close connections from their goroutine, so it doesn't wait for a
+// write stuck on a slow client: the end of the stream is only written
+// when no write is in progress, and then only for a moment.
+func (cc *compressedConn) Close() error {
+	if cc.mu.TryLock() {
+		cc.Conn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+		cc.w.Close()
+		cc.mu.Unlock()
+	}
+	return cc.Conn.Close()
+}
@@ -0,0 +1,44 @@
+package roomcast
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCompressedConnCloseDuringWrite(t *testing.T) {
+	clientEnd, serverEnd := net.Pipe()
+	defer clientEnd.Close()
+	cc := newCompressedConn(serverEnd, bufio.NewReader(serverEnd))
+
+	// Nobody reads the client's end, so the write hangs.
+	written := make(chan error, 1)
+	go func() {
+		_, err := cc.Write([]byte("hello\n"))
+		written <- err
+	}()
+	waitFor(t, "the write to start", func() bool {
+		if cc.mu.TryLock() {
+			cc.mu.Unlock()
+			return false
+		}
+		return true
+	})
+
+	closed := make(chan error, 1)
+	go func() { closed <- cc.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close waited for the write in progress")
+	}
+	select {
+	case err := <-written:
+		if err == nil {
+			t.Error("write succeeded on a closed connection")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("write still hanging after Close")
+	}
+}
@@ -0,0 +1,316 @@
+package roomcast
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config holds the server settings, usually populated from command line flags.
+type Config struct {
+	// Port is the network port on which the server listens for
+	// connections. Zero picks any free port, which Server.Addr reports
+	// once the server is started.
+	Port int
+
+	// AdminPassword lets clients become admins with /admin <password>.
+	// Admin commands are disabled when it is empty.
+	AdminPassword string
+
+	// TLSCert and TLSKey are the PEM files of the certificate and
+	// private key used to accept TLS connections. Clients connect over
+	// plain TCP when both are empty.
+	TLSCert string
+	TLSKey  string
+
+	// MetricsAddr is the address Prometheus metrics are served on at
+	// /metrics, e.g. ":9100". Metrics are disabled when it is empty.
+	MetricsAddr string
+
+	// AdminAddr is the address of the HTTP endpoint operators send
+	// announcements to, e.g. "127.0.0.1:9090". It is disabled when empty.
+	AdminAddr string
+
+	// RateLimit is the number of messages per second a client may
+	// send on average. Rate limiting is disabled when it is zero.
+	RateLimit float64
+
+	// RateBurst is the number of messages a client may send at once.
+	RateBurst int
+
+	// ViolationWindow is how long rate limit violations are remembered.
+	ViolationWindow time.Duration
+
+	// CooldownBase is the send cooldown applied on the second violation
+	// within the window, doubled on each further violation.
+	CooldownBase time.Duration
+
+	// CooldownMax caps the send cooldown.
+	CooldownMax time.Duration
+
+	// KickAfterViolations disconnects a client after that many
+	// violations within the window. Zero never kicks.
+	KickAfterViolations int
+
+	// ByteRate is the number of bytes per second a client may send on
+	// average over ByteRateWindow. It is enforced independently of
+	// RateLimit and disabled when zero.
+	ByteRate int
+
+	// ByteRateWindow is the sliding window over which ByteRate applies.
+	ByteRateWindow time.Duration
+
+	// KeepAlivePeriod is the interval between TCP keepalive probes on
+	// client connections. Zero keeps the system default.
+	KeepAlivePeriod time.Duration
+
+	// Heartbeat is how often a silent client is sent a PING. Clients
+	// that don't answer maxMissedHeartbeats in a row are disconnected.
+	// Zero disables heartbeats.
+	Heartbeat time.Duration
+
+	// MaxClients is the most members a room holds at once.
+	MaxClients int
+
+	// IdleTimeout disconnects clients that haven't sent a message for
+	// that long, freeing their room slots. Zero never disconnects them.
+	IdleTimeout time.Duration
+
+	// SetupTimeout is how long a new client has to choose its username
+	// and room before being disconnected. Zero waits forever.
+	SetupTimeout time.Duration
+
+	// WriteTimeout bounds every write to a client. Zero means no deadline.
+	WriteTimeout time.Duration
+
+	// MaxRoomsPerUser is the most rooms a username may create. Rooms
+	// stay open until the server stops, empty or not. Zero means no
+	// limit.
+	MaxRoomsPerUser int
+
+	// MaxConnsPerIP is the most client connections, TCP or WebSocket,
+	// being set up or in rooms, a single IP address may have open.
+	// Behind a PROXY load balancer, a connection counts against the
+	// balancer's address until its header names the client. Zero means
+	// no limit.
+	MaxConnsPerIP int
+
+	// DrainTimeout disconnects clients that have messages queued but
+	// haven't taken any off their queue for that long, catching stuck
+	// writes before they fail. Zero disables the check.
+	DrainTimeout time.Duration
+
+	// PasteWindow is the longest gap between lines that arrive as part
+	// of the same paste: such lines are sent as a single message rather
+	// than one message each. Zero sends every line on its own.
+	PasteWindow time.Duration
+
+	// UsernamePattern and RoomNamePattern are the regular expressions
+	// usernames and room names must match, on top of the length limits.
+	UsernamePattern string
+	RoomNamePattern string
+
+	// MinUsernameLength and MaxUsernameLength bound the number of
+	// characters in a username.
+	MinUsernameLength int
+	MaxUsernameLength int
+
+	// NameDisplayWidth is the number of characters of a name shown in
+	// prompts and messages before it is cut with an ellipsis.
+	// Zero shows names in full.
+	NameDisplayWidth int
+
+	// RejoinTTL is how long the server remembers the last room of a
+	// username on an address for /rejoin. Zero disables /rejoin.
+	RejoinTTL time.Duration
+
+	// WSAddr is the address of the WebSocket gateway browsers connect
+	// to, e.g. ":8080". The gateway is disabled when it is empty.
+	WSAddr string
+
+	// FederationAddr is the address on which peer servers can link
+	// to this one. Federation listening is disabled when it is empty.
+	FederationAddr string
+
+	// Peers are the addresses of the peer servers to link to.
+	Peers []string
+
+	// FederationSecret must be shared by linked servers. It is required
+	// when FederationAddr or Peers is set.
+	FederationSecret string
+
+	// Motd is the message of the day shown to clients when they join a
+	// room, unless the room has its own. Nothing is shown when empty.
+	Motd string
+
+	// ProxyProtocol makes the server expect a PROXY protocol v1 header
+	// on every connection and use the client address it carries.
+	// Only enable it behind a trusted load balancer.
+	ProxyProtocol bool
+
+	// Protocol is how clients exchange messages: protocolLine, one per
+	// line of text, or protocolFramed, length-prefixed JSON.
+	Protocol string
+
+	// LineSpacing is how messages are spaced in terminals:
+	// spacingCompact, one under the other, or spacingSpaced, with a
+	// blank line between them.
+	LineSpacing string
+
+	// HistoryLimit is the number of messages kept in each room's
+	// history file and replayed on join. Zero keeps everything.
+	HistoryLimit int
+
+	// HistoryOnJoin sends the room history to clients when they join.
+	HistoryOnJoin bool
+
+	// HistoryDir is the directory holding the room history files.
+	// It is created at startup if missing.
+	HistoryDir string
+
+	// HistoryQueue is the number of messages each room queues for a
+	// background writer that saves them to its history file in
+	// batches. Messages are saved as they are sent when it is zero.
+	HistoryQueue int
+
+	// HistoryOverflow is what happens to a message when the history
+	// queue of its room is full: overflowBlock waits for the writer,
+	// overflowDrop leaves the message out of the history file.
+	HistoryOverflow string
+
+	// JoinRate is the number of new members per second a room admits
+	// on average. Admission control is disabled when it is zero.
+	JoinRate float64
+
+	// JoinBurst is the number of members a room admits at once.
+	JoinBurst int
+
+	// EventBuffer is the capacity of the channel returned by Server.Events.
+	EventBuffer int
+
+	// BlockOnEvents makes the server wait for a full events channel
+	// to be drained instead of dropping connection, join and room
+	// creation events. Events from the rooms themselves are still
+	// dropped, see Server.Events. Only enable it when something always
+	// reads the events.
+	BlockOnEvents bool
+}
+
+// defaultPort is the port the server listens on by default.
+const defaultPort = 11111
+
+// DefaultConfig returns the configuration used when no flags are given.
+func DefaultConfig() Config {
+	return Config{
+		Port:              defaultPort,
+		RateBurst:         5,
+		ViolationWindow:   time.Minute,
+		CooldownBase:      5 * time.Second,
+		CooldownMax:       5 * time.Minute,
+		ByteRateWindow:    10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		SetupTimeout:      30 * time.Second,
+		MaxClients:        defaultMaxClients,
+		UsernamePattern:   defaultNamePattern,
+		RoomNamePattern:   defaultNamePattern,
+		NameDisplayWidth:  defaultNameDisplayWidth,
+		MinUsernameLength: defaultMinUsernameLength,
+		MaxUsernameLength: defaultMaxUsernameLength,
+		RejoinTTL:         24 * time.Hour,
+		Protocol:          protocolLine,
+		LineSpacing:       spacingCompact,
+		HistoryDir:        "history",
+		HistoryOnJoin:     true,
+		HistoryLimit:      maxHistory,
+		HistoryOverflow:   overflowBlock,
+		JoinBurst:         10,
+		EventBuffer:       64,
+	}
+}
+
+// normalize fills the fields left at zero with the defaults of
+// DefaultConfig, so that a Config literal only needs the settings it
+// changes, and rejects invalid values. Fields where zero has a meaning
+// of its own, such as Port, WriteTimeout or HistoryLimit, are left
+// alone.
+func (cfg *Config) normalize() error {
+	def := DefaultConfig()
+	orDefault(&cfg.MaxClients, def.MaxClients)
+	orDefault(&cfg.RateBurst, def.RateBurst)
+	orDefault(&cfg.ViolationWindow, def.ViolationWindow)
+	orDefault(&cfg.CooldownBase, def.CooldownBase)
+	orDefault(&cfg.CooldownMax, def.CooldownMax)
+	orDefault(&cfg.ByteRateWindow, def.ByteRateWindow)
+	orDefault(&cfg.UsernamePattern, def.UsernamePattern)
+	orDefault(&cfg.RoomNamePattern, def.RoomNamePattern)
+	orDefault(&cfg.MinUsernameLength, def.MinUsernameLength)
+	orDefault(&cfg.MaxUsernameLength, def.MaxUsernameLength)
+	orDefault(&cfg.Protocol, def.Protocol)
+	orDefault(&cfg.LineSpacing, def.LineSpacing)
+	orDefault(&cfg.HistoryDir, def.HistoryDir)
+	orDefault(&cfg.HistoryOverflow, def.HistoryOverflow)
+	orDefault(&cfg.JoinBurst, def.JoinBurst)
+
+	if cfg.Port < 0 || cfg.Port > 65535 {
+		return fmt.Errorf("port %d is out of range", cfg.Port)
+	}
+	if cfg.MinUsernameLength < 1 || cfg.MaxUsernameLength < cfg.MinUsernameLength {
+		return fmt.Errorf("invalid username length range %d-%d", cfg.MinUsernameLength, cfg.MaxUsernameLength)
+	}
+	if cfg.MaxClients < 1 {
+		return fmt.Errorf("max clients must be at least 1")
+	}
+	if cfg.Protocol != protocolLine && cfg.Protocol != protocolFramed {
+		return fmt.Errorf("unknown protocol %q, use %s or %s", cfg.Protocol, protocolLine, protocolFramed)
+	}
+	if cfg.LineSpacing != spacingCompact && cfg.LineSpacing != spacingSpaced {
+		return fmt.Errorf("unknown line spacing %q, use %s or %s", cfg.LineSpacing, spacingCompact, spacingSpaced)
+	}
+	if cfg.HistoryOverflow != overflowBlock && cfg.HistoryOverflow != overflowDrop {
+		return fmt.Errorf("unknown history overflow %q, use %s or %s", cfg.HistoryOverflow, overflowBlock, overflowDrop)
+	}
+	if (cfg.FederationAddr != "" || len(cfg.Peers) > 0) && cfg.FederationSecret == "" {
+		return fmt.Errorf("federation needs a shared secret")
+	}
+	for _, setting := range []struct {
+		name  string
+		value float64
+	}{
+		{"history limit", float64(cfg.HistoryLimit)},
+		{"history queue", float64(cfg.HistoryQueue)},
+		{"max rooms per user", float64(cfg.MaxRoomsPerUser)},
+		{"max conns per IP", float64(cfg.MaxConnsPerIP)},
+		{"rate", cfg.RateLimit},
+		{"byte rate", float64(cfg.ByteRate)},
+		{"join rate", cfg.JoinRate},
+		{"kick after", float64(cfg.KickAfterViolations)},
+		{"name width", float64(cfg.NameDisplayWidth)},
+		{"event buffer", float64(cfg.EventBuffer)},
+		{"write timeout", float64(cfg.WriteTimeout)},
+		{"drain timeout", float64(cfg.DrainTimeout)},
+		{"setup timeout", float64(cfg.SetupTimeout)},
+		{"idle timeout", float64(cfg.IdleTimeout)},
+		{"paste window", float64(cfg.PasteWindow)},
+		{"heartbeat", float64(cfg.Heartbeat)},
+		{"keepalive period", float64(cfg.KeepAlivePeriod)},
+		{"rejoin TTL", float64(cfg.RejoinTTL)},
+		{"violation window", float64(cfg.ViolationWindow)},
+		{"cooldown", float64(cfg.CooldownBase)},
+		{"max cooldown", float64(cfg.CooldownMax)},
+		{"byte rate window", float64(cfg.ByteRateWindow)},
+		{"rate burst", float64(cfg.RateBurst)},
+		{"join burst", float64(cfg.JoinBurst)},
+	} {
+		if setting.value < 0 {
+			return fmt.Errorf("%s must not be negative", setting.name)
+		}
+	}
+	return nil
+}
+
+// orDefault sets *v to def if it is the zero value.
+func orDefault[T comparable](v *T, def T) {
+	var zero T
+	if *v == zero {
+		*v = def
+	}
+}
@@ -0,0 +1,82 @@
+package roomcast
+
+import (
+	"net"
+	"sync"
+)
+
+// countedConn is a connection counted against Config.MaxConnsPerIP.
+// Closing it, however many times and from whichever wrapper, gives its
+// slot back once.
+type countedConn struct {
+	net.Conn
+	server *Server
+	once   sync.Once
+
+	// ip is the address the connection is counted against, guarded by
+	// server.mu. It changes when a PROXY header names the client.
+	ip string
+}
+
+func (cc *countedConn) Close() error {
+	cc.once.Do(func() { cc.server.releaseConn(cc) })
+	return cc.Conn.Close()
+}
+
+// countConn counts conn against the connections of its IP address and
+// returns it wrapped so that closing it releases the slot. It returns
+// false when the address already has Config.MaxConnsPerIP connections.
+func (s *Server) countConn(conn net.Conn) (net.Conn, bool) {
+	if s.cfg.MaxConnsPerIP <= 0 {
+		return conn, true
+	}
+
+	ip := remoteIP(conn)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.connsPerIP[ip] >= s.cfg.MaxConnsPerIP {
+		return conn, false
+	}
+	s.connsPerIP[ip]++
+	return &countedConn{Conn: conn, server: s, ip: ip}, true
+}
+
+// recountConn moves the slot of conn, as returned by countConn, to ip,
+// the client's address read from a PROXY header. It returns false,
+// leaving the slot where it was, when ip already has
+// Config.MaxConnsPerIP connections.
+func (s *Server) recountConn(conn net.Conn, ip string) bool {
+	cc, ok := conn.(*countedConn)
+	if !ok {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cc.ip == ip {
+		return true
+	}
+	if s.connsPerIP[ip] >= s.cfg.MaxConnsPerIP {
+		return false
+	}
+	s.uncount(cc.ip)
+	s.connsPerIP[ip]++
+	cc.ip = ip
+	return true
+}
+
+// releaseConn gives back the connection slot of cc.
+func (s *Server) releaseConn(cc *countedConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uncount(cc.ip)
+}
+
+// uncount removes a connection from the count of ip. The caller must
+// hold s.mu.
+func (s *Server) uncount(ip string) {
+	s.connsPerIP[ip]--
+	if s.connsPerIP[ip] <= 0 {
+		delete(s.connsPerIP, ip)
+	}
+}
@@ -0,0 +1,120 @@
+package roomcast
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// dialFrom connects to addr from the loopback address ip, so tests can
+// play several hosts.
+func dialFrom(t *testing.T, ip, addr string) net.Conn {
+	t.Helper()
+	dialer := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(ip)}}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial from %s: %v", ip, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// prompted reports whether c got the username prompt rather than being
+// turned away for having too many connections.
+func prompted(c *testClient) bool {
+	c.t.Helper()
+	if c.expectOneOf("Enter username", "Too many connections from your address (at most 2)") == "Enter username" {
+		return true
+	}
+	c.expectClosed()
+	return false
+}
+
+func TestMaxConnsPerIP(t *testing.T) {
+	var opened int
+	tests := []struct {
+		name  string
+		proxy bool
+		// open connects a client from ip to server, or to its WebSocket
+		// gateway, and reports whether the server took it.
+		open func(t *testing.T, server *Server, gateway, ip string) (net.Conn, bool)
+	}{
+		{
+			name: "direct",
+			open: func(t *testing.T, server *Server, gateway, ip string) (net.Conn, bool) {
+				c := &testClient{t: t, conn: dialFrom(t, ip, server.Addr().String())}
+				return c.conn, prompted(c)
+			},
+		},
+		{
+			name:  "behind a PROXY header",
+			proxy: true,
+			open: func(t *testing.T, server *Server, gateway, ip string) (net.Conn, bool) {
+				// Every connection comes from the balancer's address.
+				c := dial(t, server)
+				c.send(fmt.Sprintf("PROXY TCP4 %s 10.0.0.1 51234 4000\r", ip))
+				return c.conn, prompted(c)
+			},
+		},
+		{
+			name: "WebSocket",
+			open: func(t *testing.T, server *Server, gateway, ip string) (net.Conn, bool) {
+				opened++
+				conn := dialFrom(t, ip, strings.TrimPrefix(gateway, "http://"))
+				fmt.Fprintf(conn, "GET /?username=user_%d&room=room_one HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", opened)
+				resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+				if err != nil {
+					t.Fatalf("reading the handshake: %v", err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusTooManyRequests {
+					t.Fatalf("handshake status = %s, want 101 or 429", resp.Status)
+				}
+				return conn, resp.StatusCode == http.StatusSwitchingProtocols
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.MaxConnsPerIP = 2
+			cfg.ProxyProtocol = tt.proxy
+			server := startServer(t, cfg)
+			gateway := httptest.NewServer(http.HandlerFunc(server.handleWebSocket))
+			t.Cleanup(gateway.Close)
+
+			open := func(ip string) (net.Conn, bool) {
+				t.Helper()
+				return tt.open(t, server, gateway.URL, ip)
+			}
+			first, ok := open("127.0.0.2")
+			if !ok {
+				t.Fatal("first connection refused")
+			}
+			if _, ok := open("127.0.0.2"); !ok {
+				t.Fatal("second connection refused")
+			}
+			if _, ok := open("127.0.0.2"); ok {
+				t.Fatal("third connection taken, want it refused")
+			}
+			if _, ok := open("127.0.0.3"); !ok {
+				t.Fatal("connection from another address refused")
+			}
+
+			// Leaving gives the slot back.
+			first.Close()
+			waitFor(t, "the first connection to be released", func() bool {
+				server.mu.RLock()
+				defer server.mu.RUnlock()
+				return server.connsPerIP["127.0.0.2"] < 2
+			})
+			if _, ok := open("127.0.0.2"); !ok {
+				t.Fatal("connection refused after another one closed")
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package roomcast
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// RoomSnapshot describes a room and its members at a point in time.
+type RoomSnapshot struct {
+	Name string
+	// Members holds the member labels, i.e. usernames followed by
+	// their status if they have one.
+	Members []string
+}
+
+// snapshot returns the rooms and their members, sorted by room name.
+func (s *Server) snapshot() []RoomSnapshot {
+	s.mu.RLock()
+	rooms := make([]*Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		rooms = append(rooms, room)
+	}
+	s.mu.RUnlock()
+
+	snapshots := make([]RoomSnapshot, 0, len(rooms))
+	for _, room := range rooms {
+		var members []string
+		for _, client := range room.members() {
+			members = append(members, client.label())
+		}
+		snapshots = append(snapshots, RoomSnapshot{Name: room.name, Members: members})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Name < snapshots[j].Name })
+	return snapshots
+}
+
+// announce sends a notification to every client in every room and
+// returns the number of rooms reached. Rooms shutting down are skipped.
+func (s *Server) announce(text string) int {
+	s.mu.RLock()
+	rooms := make([]*Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		rooms = append(rooms, room)
+	}
+	s.mu.RUnlock()
+
+	reached := 0
+	for _, room := range rooms {
+		sent := room.do(func() {
+			room.broadcast(&Message{
+				Content: fmt.Sprintf("📣 %s\n", text),
+				Type:    NotificationType,
+				Room:    room.name,
+			}, nil)
+		})
+		if sent {
+			reached++
+		}
+	}
+	slog.Info("📣 Announcement sent", "rooms", reached, "text", text)
+	return reached
+}
+
+// kick disconnects a user from a room.
+func (s *Server) kick(roomName, username string) error {
+	s.mu.RLock()
+	room, ok := s.rooms[strings.ToUpper(roomName)]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no room named %s", roomName)
+	}
+
+	if !room.kick(strings.ToLower(username)) {
+		return fmt.Errorf("no user named %s in %s", username, room.name)
+	}
+	slog.Info("👢 Kicked from the console", "user", username, "room", room.name)
+	return nil
+}
+
+// RunConsole reads operator commands from in, one per line, and writes
+// their output to out. It returns when in is exhausted, or closes stop
+// and returns when the shutdown command is entered.
+func (s *Server) RunConsole(in io.Reader, out io.Writer, stop chan<- struct{}) {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch cmd, args := strings.ToLower(fields[0]), fields[1:]; cmd {
+		case "help":
+			fmt.Fprintln(out, "Commands: list, announce <text>, kick <room> <user>, shutdown")
+
+		case "list":
+			snapshots := s.snapshot()
+			if len(snapshots) == 0 {
+				fmt.Fprintln(out, "📭 No rooms.")
+			}
+			for _, room := range snapshots {
+				fmt.Fprintf(out, "🏠 %s (%d): %s\n", room.Name, len(room.Members), strings.Join(room.Members, ", "))
+			}
+
+		case "announce":
+			if len(args) == 0 {
+				fmt.Fprintln(out, "❌ Usage: announce <text>")
+				continue
+			}
+			s.announce(strings.Join(args, " "))
+
+		case "kick":
+			if len(args) != 2 {
+				fmt.Fprintln(out, "❌ Usage: kick <room> <user>")
+				continue
+			}
+			if err := s.kick(args[0], args[1]); err != nil {
+				fmt.Fprintf(out, "❌ %v\n", err)
+			}
+
+		case "shutdown":
+			close(stop)
+			return
+
+		default:
+			fmt.Fprintf(out, "❌ Unknown command: %s, try help\n", cmd)
+		}
+	}
+}
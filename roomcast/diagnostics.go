@@ -0,0 +1,59 @@
+package roomcast
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// diagnosticsTimeout is how long Diagnostics waits for a busy room.
+const diagnosticsTimeout = time.Second
+
+// Diagnostics describes the state of the server for debugging stuck
+// servers: rooms, their members and how full their send buffers are,
+// and the number of goroutines. Rooms whose goroutine doesn't answer
+// within diagnosticsTimeout are reported as unresponsive.
+func (s *Server) Diagnostics() string {
+	s.mu.RLock()
+	rooms := make([]*Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		rooms = append(rooms, room)
+	}
+	clients, peers := len(s.clients), len(s.peers)
+	s.mu.RUnlock()
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].name < rooms[j].name })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "🩺 Diagnostics: %d goroutines, %d rooms, %d clients, %d peers\n",
+		runtime.NumGoroutine(), len(rooms), clients, peers)
+
+	for _, room := range rooms {
+		select {
+		case <-room.ctx.Done():
+			fmt.Fprintf(&b, "  🏠 %s: stopped\n", room.name)
+			continue
+		default:
+		}
+
+		report := make(chan string, 1)
+		go room.do(func() {
+			var members []string
+			for client := range room.clients {
+				members = append(members, fmt.Sprintf("%s (send %d/%d, urgent %d/%d)", client.name(),
+					len(client.send), cap(client.send), len(client.urgent), cap(client.urgent)))
+			}
+			sort.Strings(members)
+			report <- fmt.Sprintf("  🏠 %s: running, %d clients: %s\n", room.name, len(members), strings.Join(members, ", "))
+		})
+
+		select {
+		case line := <-report:
+			b.WriteString(line)
+		case <-time.After(diagnosticsTimeout):
+			fmt.Fprintf(&b, "  🏠 %s: unresponsive for %v\n", room.name, diagnosticsTimeout)
+		}
+	}
+	return b.String()
+}
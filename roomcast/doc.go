@@ -0,0 +1,14 @@
+// Package roomcast implements the room-cast chat server: clients connect
+// over TCP, or WebSocket when enabled, pick a username and a room, and
+// every message posted in a room is broadcast to its members.
+//
+// The room-cast command is a thin wrapper around this package, which can
+// also be embedded in another program, as the package example shows:
+// create the server with NewServer from a Config, usually DefaultConfig
+// with some fields changed, then run it with Start.
+//
+// Start returns once the server is shut down, when its context is done
+// or Shutdown is called. Call Shutdown with a deadline to bound how long
+// the rooms have to disconnect their members. Setting Config.Port to
+// zero listens on any free port, which Addr reports.
+package roomcast
@@ -0,0 +1,62 @@
+package roomcast
+
+import (
+	"errors"
+	"time"
+)
+
+// Error codes sent along with the errors shown to clients, so that bots
+// can tell errors apart without parsing the text.
+const (
+	CodeUsage          = "USAGE"
+	CodeUnknownCommand = "UNKNOWN_COMMAND"
+	CodeInvalidName    = "INVALID_NAME"
+	CodeNameTaken      = "NAME_TAKEN"
+	CodeForbidden      = "FORBIDDEN"
+	CodeWrongPassword  = "WRONG_PASSWORD"
+	CodeRoomFull       = "ROOM_FULL"
+	CodeJoinThrottled  = "JOIN_THROTTLED"
+	CodeRateLimited    = "RATE_LIMITED"
+	CodeTooLarge       = "TOO_LARGE"
+	CodeLimitReached   = "LIMIT_REACHED"
+	CodeNotFound       = "NOT_FOUND"
+	CodeUndeliverable  = "UNDELIVERABLE"
+	CodeInvalidState   = "INVALID_STATE"
+	CodeKicked         = "KICKED"
+	CodeTimeout        = "TIMEOUT"
+	CodeInternal       = "INTERNAL"
+)
+
+// newError builds an error message for a client: text is shown to
+// humans and code, one of the Code constants, is meant for bots.
+func newError(code, text string) Message {
+	return Message{
+		Content:   text,
+		Timestamp: time.Now(),
+		Type:      ErrorType,
+		Code:      code,
+	}
+}
+
+// writeError writes an error to the client.
+func (c *Client) writeError(code, text string) error {
+	msg := newError(code, text)
+	return c.writeOut(func() error { return c.out.writeMessage(msg, msg.formatAndConvertToBytes(c.server.style)) })
+}
+
+// joinErrorCode returns the error code matching a failed join.
+func joinErrorCode(err error) string {
+	switch {
+	case errors.Is(err, errRoomFull):
+		return CodeRoomFull
+	case errors.Is(err, errJoinThrottled):
+		return CodeJoinThrottled
+	case errors.Is(err, errNameTaken):
+		return CodeNameTaken
+	case errors.Is(err, errWrongPassword):
+		return CodeWrongPassword
+	case errors.Is(err, errBanned):
+		return CodeForbidden
+	}
+	return CodeInternal
+}
@@ -0,0 +1,65 @@
+package roomcast
+
+import (
+	"time"
+)
+
+// EventType identifies a connection lifecycle event.
+type EventType string
+
+const (
+	EventClientConnected    EventType = "client_connected"
+	EventClientJoined       EventType = "client_joined"
+	EventClientLeft         EventType = "client_left"
+	EventClientDisconnected EventType = "client_disconnected"
+	EventRoomCreated        EventType = "room_created"
+	EventRoomClosed         EventType = "room_closed"
+)
+
+// Event describes something that happened to a client or a room.
+// Room and Username are empty when they don't apply.
+type Event struct {
+	Type       EventType
+	Room       string
+	Username   string
+	RemoteAddr string
+	Time       time.Time
+}
+
+// Events returns the channel on which lifecycle events are published.
+// With the default configuration events are dropped when the channel
+// is full, so a slow consumer never blocks the server; with
+// Config.BlockOnEvents the server waits for the consumer instead, but
+// only before publishing client_connected, client_joined,
+// client_disconnected and room_created events. The others come from
+// the room goroutines, which never wait, so they are still dropped
+// when the channel is full.
+func (s *Server) Events() <-chan Event {
+	return s.events
+}
+
+// emit publishes an event according to the configured policy. It must
+// not be called with s.mu held or from a room goroutine, which use
+// tryEmit.
+func (s *Server) emit(event Event) {
+	event.Time = time.Now()
+
+	if s.cfg.BlockOnEvents {
+		s.events <- event
+		return
+	}
+	s.tryEmit(event)
+}
+
+// tryEmit publishes an event unless the channel is full, whatever the
+// policy.
+func (s *Server) tryEmit(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	select {
+	case s.events <- event:
+	default:
+	}
+}
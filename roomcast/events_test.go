@@ -0,0 +1,73 @@
+package roomcast
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBlockOnEvents(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.BlockOnEvents = true
+	cfg.EventBuffer = 1
+	// The consumer reads events unless paused by holding hold, and
+	// keeps reading until the server is shut down.
+	var hold sync.Mutex
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	server := startServer(t, cfg)
+	go func() {
+		for {
+			hold.Lock()
+			select {
+			case <-server.Events():
+			case <-time.After(10 * time.Millisecond):
+			}
+			hold.Unlock()
+
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}()
+
+	alice := join(t, server, "alice", "room_one")
+	bobby := join(t, server, "bobby", "room_one")
+	carol := join(t, server, "carol", "room_one")
+	alice.expect("bobby has joined the room")
+	alice.expect("carol has joined the room")
+
+	hold.Lock()
+	paused := true
+	resume := func() {
+		if paused {
+			paused = false
+			hold.Unlock()
+		}
+	}
+	t.Cleanup(resume)
+	waitFor(t, "the consumer to catch up", func() bool { return len(server.Events()) == 0 })
+	dave := dial(t, server)
+	dave.expect("Enter username: ")
+	alice.send("/join room_two")
+	waitFor(t, "ROOM_TWO to be created", func() bool { return testutil.ToFloat64(server.metrics.rooms) == 2 })
+
+	// Creating ROOM_TWO waits for the consumer, without holding up
+	// other lookups or the rooms.
+	names := make(chan []string, 1)
+	go func() { names <- server.RoomNames() }()
+	select {
+	case <-names:
+	case <-time.After(time.Second):
+		t.Fatal("RoomNames waited for the consumer")
+	}
+	bobby.send("/quit")
+	carol.expect("bobby has left the room")
+
+	resume()
+	alice.expect("alice 🏠 ROOM_TWO" + ColorReset + " > ")
+}
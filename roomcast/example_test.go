@@ -0,0 +1,34 @@
+package roomcast_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/biramendoye/room-cast/roomcast"
+)
+
+// This example runs the server until the program is interrupted,
+// logging who joins and leaves which room.
+func Example() {
+	cfg := roomcast.DefaultConfig()
+	cfg.Port = 4000
+	cfg.HistoryDir = "/var/lib/chat"
+
+	server, err := roomcast.NewServer(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		for event := range server.Events() {
+			log.Printf("%s %s %s", event.Type, event.Room, event.Username)
+		}
+	}()
+	if err := server.Start(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,247 @@
+package roomcast
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// federationHello starts both lines of the handshake. The server
+	// dialing sends it with its ID and the shared secret, and the one
+	// accepting answers with its own ID.
+	federationHello = "ROOMCAST-FEDERATION"
+
+	// federationRetry is the delay before redialing a lost peer.
+	federationRetry = 5 * time.Second
+
+	// handshakeTimeout bounds the wait for the other side's handshake.
+	handshakeTimeout = 10 * time.Second
+
+	// peerBufferSize bounds the messages queued for a slow peer.
+	peerBufferSize = 256
+)
+
+// peerLink is a connection to another room-cast server. Messages
+// forwarded in a local room are relayed to the peer, which delivers
+// them to the members of its room of the same name.
+type peerLink struct {
+	conn net.Conn
+	addr string
+	send chan []byte
+
+	// id is the peer's ID, and dialer the ID of the server that dialed
+	// the link, telling apart the two links of servers that both list
+	// each other.
+	id     string
+	dialer string
+}
+
+// startFederation listens for peers on Config.FederationAddr and dials
+// every address in Config.Peers.
+func (s *Server) startFederation() error {
+	if s.cfg.FederationAddr != "" {
+		ln, err := net.Listen("tcp", s.cfg.FederationAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for peers: %w", err)
+		}
+		s.mu.Lock()
+		s.fedListener = ln
+		s.mu.Unlock()
+		slog.Info("🌐 Listening for peers", "addr", s.cfg.FederationAddr)
+		go s.acceptPeers(ln)
+	}
+
+	for _, addr := range s.cfg.Peers {
+		go s.dialPeer(addr)
+	}
+	return nil
+}
+
+// acceptPeers accepts links from peers that know the shared secret.
+func (s *Server) acceptPeers(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			reader := bufio.NewReader(conn)
+			conn.SetDeadline(time.Now().Add(handshakeTimeout))
+			hello, err := reader.ReadString('\n')
+			var id, secret string
+			if err == nil {
+				_, id, secret = splitHello(hello)
+			}
+			if id == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(s.cfg.FederationSecret)) != 1 {
+				slog.Warn("🚨 Rejected peer, bad handshake", "addr", conn.RemoteAddr())
+				conn.Close()
+				return
+			}
+			if _, err := fmt.Fprintf(conn, "%s %s\n", federationHello, s.fedID); err != nil {
+				conn.Close()
+				return
+			}
+			conn.SetDeadline(time.Time{})
+			s.runPeer(conn, reader, conn.RemoteAddr().String(), id, id)
+		}()
+	}
+}
+
+// dialPeer keeps a link open to the peer at addr, redialing after
+// federationRetry whenever it is lost, until the server shuts down.
+func (s *Server) dialPeer(addr string) {
+	for !s.isShuttingDown() {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			slog.Warn("🌐 Peer unreachable", "addr", addr, "err", err)
+		} else {
+			reader := bufio.NewReader(conn)
+			conn.SetDeadline(time.Now().Add(handshakeTimeout))
+			fmt.Fprintf(conn, "%s %s %s\n", federationHello, s.fedID, s.cfg.FederationSecret)
+			answer, err := reader.ReadString('\n')
+			var id string
+			if err == nil {
+				hello, rest, _ := splitHello(answer)
+				if hello == federationHello {
+					id = rest
+				}
+			}
+			if id == "" {
+				slog.Warn("🚨 Peer refused the handshake", "addr", addr)
+				conn.Close()
+			} else {
+				conn.SetDeadline(time.Time{})
+				s.runPeer(conn, reader, addr, id, s.fedID)
+			}
+		}
+		time.Sleep(federationRetry)
+	}
+}
+
+// splitHello splits a handshake line into its words, the last one
+// keeping any spaces of the secret.
+func splitHello(line string) (hello, id, secret string) {
+	words := strings.SplitN(strings.TrimRight(line, "\r\n"), " ", 3)
+	if len(words) < 2 || words[0] != federationHello {
+		return "", "", ""
+	}
+	if len(words) == 3 {
+		secret = words[2]
+	}
+	return words[0], words[1], secret
+}
+
+// addPeer registers link, unless it leads back to this server or the
+// peer is already linked. When two servers list each other, both keep
+// the link dialed by the server with the smaller ID, so messages
+// aren't relayed twice.
+func (s *Server) addPeer(link *peerLink) bool {
+	if link.id == s.fedID {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for other := range s.peers {
+		if other.id != link.id {
+			continue
+		}
+		if other.dialer < link.dialer {
+			return false
+		}
+		// Either the other link is the one to drop, or it was dialed
+		// the same way and is likely dead.
+		delete(s.peers, other)
+		other.conn.Close()
+	}
+	s.peers[link] = struct{}{}
+	return true
+}
+
+// runPeer relays messages over an established link until it breaks.
+func (s *Server) runPeer(conn net.Conn, reader *bufio.Reader, addr, id, dialer string) {
+	link := &peerLink{conn: conn, addr: addr, send: make(chan []byte, peerBufferSize), id: id, dialer: dialer}
+	if !s.addPeer(link) {
+		slog.Debug("🌐 Already linked with peer", "addr", addr)
+		conn.Close()
+		return
+	}
+	slog.Info("🌐 Linked with peer", "addr", addr)
+
+	go func() {
+		for msg := range link.send {
+			if _, err := conn.Write(append(msg, '\n')); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+		s.receiveFederated(line, addr)
+	}
+
+	s.mu.Lock()
+	delete(s.peers, link)
+	s.mu.Unlock()
+	close(link.send)
+	conn.Close()
+	slog.Warn("🌐 Lost peer", "addr", addr)
+}
+
+// receiveFederated delivers a chat message relayed by a peer to the
+// local room of the same name, if there is one. Only its content,
+// sender and room are kept: peers can't send notices, errors or
+// private messages to local clients.
+func (s *Server) receiveFederated(line []byte, addr string) {
+	relayed, err := FromJSON(line)
+	if err != nil || relayed.Type != UserMessageType || !s.isValidUsername(relayed.Sender) {
+		slog.Error("❌ Invalid message from peer", "addr", addr)
+		return
+	}
+
+	s.mu.RLock()
+	room, ok := s.rooms[relayed.Room]
+	s.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	msg := NewMessage(relayed.Content, relayed.Sender, UserMessageType)
+	msg.Room = room.name
+	msg.Origin = addr
+	select {
+	case room.forward <- msg.ToJSON():
+	case <-room.ctx.Done():
+	}
+}
+
+// federate relays a locally posted message to every peer. Peers that
+// can't keep up miss the message rather than slowing the room down.
+func (s *Server) federate(msg Message) {
+	if msg.Origin != "" {
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data := msg.ToJSON()
+	for link := range s.peers {
+		select {
+		case link.send <- data:
+		default:
+			slog.Warn("❌ Peer too slow, message dropped", "addr", link.addr)
+		}
+	}
+}
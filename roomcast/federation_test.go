@@ -0,0 +1,173 @@
+package roomcast
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startFederated starts a server accepting peers that know the secret
+// "s3cret", and returns it with the address peers link to.
+func startFederated(t *testing.T) (*Server, string) {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.FederationAddr = "127.0.0.1:0"
+	cfg.FederationSecret = "s3cret"
+	server := startServer(t, cfg)
+
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	return server, server.fedListener.Addr().String()
+}
+
+// linkTo sends hello to the federation listener at addr and returns the
+// connection with a reader of its answers.
+func linkTo(t *testing.T, addr, hello string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, err := fmt.Fprintf(conn, "%s\n", hello); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(testTimeout))
+	return conn, bufio.NewReader(conn)
+}
+
+func TestNewServerFederationSecret(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(*Config)
+	}{
+		{name: "listening", cfg: func(cfg *Config) { cfg.FederationAddr = "127.0.0.1:0" }},
+		{name: "dialing", cfg: func(cfg *Config) { cfg.Peers = []string{"127.0.0.1:11112"} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.cfg(&cfg)
+			if _, err := NewServer(cfg); err == nil {
+				t.Fatal("NewServer without a federation secret succeeded")
+			}
+			cfg.FederationSecret = "s3cret"
+			if _, err := NewServer(cfg); err != nil {
+				t.Fatalf("NewServer with a federation secret: %v", err)
+			}
+		})
+	}
+}
+
+func TestFederationHandshake(t *testing.T) {
+	tests := []struct {
+		name     string
+		hello    string
+		accepted bool
+	}{
+		{name: "right secret", hello: "ROOMCAST-FEDERATION peer_one s3cret", accepted: true},
+		{name: "wrong secret", hello: "ROOMCAST-FEDERATION peer_one s3cre"},
+		{name: "no secret", hello: "ROOMCAST-FEDERATION peer_one"},
+		{name: "bare hello", hello: "ROOMCAST-FEDERATION"},
+		{name: "empty secret", hello: "ROOMCAST-FEDERATION peer_one "},
+		{name: "not a hello", hello: "HELLO peer_one s3cret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, addr := startFederated(t)
+			_, reader := linkTo(t, addr, tt.hello)
+
+			answer, err := reader.ReadString('\n')
+			if !tt.accepted {
+				if err == nil {
+					t.Fatalf("got %q, want the link closed", answer)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("reading the answer: %v", err)
+			}
+			if want := federationHello + " " + server.fedID + "\n"; answer != want {
+				t.Errorf("answer = %q, want %q", answer, want)
+			}
+			waitFor(t, "the peer to be linked", func() bool {
+				server.mu.RLock()
+				defer server.mu.RUnlock()
+				return len(server.peers) == 1
+			})
+		})
+	}
+}
+
+func TestReceiveFederated(t *testing.T) {
+	server, addr := startFederated(t)
+	alice := join(t, server, "alice", "room_one")
+	peer, reader := linkTo(t, addr, "ROOMCAST-FEDERATION peer_one s3cret")
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatalf("reading the answer: %v", err)
+	}
+
+	relay := func(msg Message) {
+		t.Helper()
+		msg.Room = "ROOM_ONE"
+		if _, err := peer.Write(append(msg.ToJSON(), '\n')); err != nil {
+			t.Fatal(err)
+		}
+	}
+	relay(newError(CodeKicked, "forged kick"))
+	relay(NewMessage("forged notice", "bobby", NotificationType))
+	relay(NewMessage("forged private message", "bobby", PrivateMessageType))
+	relay(NewMessage("forged sender", "🤖 root", UserMessageType))
+	relay(NewMessage("relayed first", "bobby", UserMessageType))
+	posted := NewMessage("hello from afar", "bobby", UserMessageType)
+	posted.Code = CodeKicked
+	relay(posted)
+
+	out := alice.expect("🤖 bobby 💬 hello from afar")
+	for _, forged := range []string{"forged kick", "forged notice", "forged private message", "forged sender"} {
+		if strings.Contains(out, forged) {
+			t.Errorf("alice got %q: %q", forged, out)
+		}
+	}
+	if !strings.Contains(out, "🤖 bobby 💬 relayed first") {
+		t.Errorf("alice didn't get the message relayed before: %q", out)
+	}
+
+	// alice is still in the room.
+	bobby := join(t, server, "bobby", "room_one")
+	bobby.send("still there?")
+	alice.expect("💬 still there?")
+}
+
+func TestFederationLinkedOnce(t *testing.T) {
+	a, aAddr := startFederated(t)
+	b, bAddr := startFederated(t)
+
+	// Both servers list each other.
+	go a.dialPeer(bAddr)
+	go b.dialPeer(aAddr)
+	link := func(server *Server) *peerLink {
+		server.mu.RLock()
+		defer server.mu.RUnlock()
+		if len(server.peers) != 1 {
+			return nil
+		}
+		for link := range server.peers {
+			return link
+		}
+		return nil
+	}
+	waitFor(t, "a single link between the servers", func() bool {
+		la, lb := link(a), link(b)
+		return la != nil && lb != nil && la.dialer == lb.dialer
+	})
+
+	alice := join(t, a, "alice", "room_one")
+	bobby := join(t, b, "bobby", "room_one")
+	alice.send("only once")
+	bobby.expect("🤖 alice 💬 only once")
+	bobby.refute("only once", 500*time.Millisecond)
+}
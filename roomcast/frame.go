@@ -0,0 +1,138 @@
+package roomcast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Protocols a client can speak, chosen with --protocol.
+const (
+	// protocolLine is the default: one message per line of text.
+	protocolLine = "line"
+
+	// protocolFramed sends every message in both directions as a
+	// 4-byte big-endian length followed by that many bytes of JSON.
+	protocolFramed = "framed"
+)
+
+// maxFrameSize bounds the frames a framed client can send, so a single
+// frame can't make the server allocate without limit.
+const maxFrameSize = 64 << 10
+
+var (
+	errFrameTooLarge = fmt.Errorf("frame larger than %d bytes", maxFrameSize)
+	errBadFrame      = errors.New("frame is not a JSON message")
+)
+
+// encodeFrame prefixes payload with its length.
+func encodeFrame(payload []byte) []byte {
+	frame := make([]byte, 4, 4+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+// decodeFrame reads the next frame from r, waiting for the rest of it
+// when it arrives in several reads. A frame over maxFrameSize is
+// skipped and errFrameTooLarge returned, so the next one can be read.
+func decodeFrame(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize {
+		if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+			return nil, err
+		}
+		return nil, errFrameTooLarge
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// readLine reads what the client typed: a line without its line ending
+// or, in framed mode, the content of the next JSON message. errBadFrame
+// and errFrameTooLarge leave the stream usable.
+func readLine(reader *bufio.Reader, framed bool) ([]byte, error) {
+	if !framed {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+
+	payload, err := decodeFrame(reader)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := FromJSON(payload)
+	if err != nil {
+		return nil, errBadFrame
+	}
+	return []byte(msg.Content), nil
+}
+
+// isFrameError reports whether err is about a single bad frame rather
+// than the connection.
+func isFrameError(err error) bool {
+	return errors.Is(err, errFrameTooLarge) || errors.Is(err, errBadFrame)
+}
+
+// framedConn is a connection in framed mode. As a transport, it sends
+// room messages as their JSON Message and server text as Notification
+// messages, each in a frame.
+type framedConn struct {
+	net.Conn
+
+	// caps are the capabilities negotiated by the client, which only
+	// affect server text since clients render room messages themselves.
+	caps capabilities
+
+	// mu serializes frame writes, which come from several goroutines.
+	mu sync.Mutex
+}
+
+func (fc *framedConn) writeFrame(payload []byte) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	_, err := fc.Conn.Write(encodeFrame(payload))
+	return err
+}
+
+// Write sends p as a Notification message, for the text written during
+// setup.
+func (fc *framedConn) Write(p []byte) (int, error) {
+	if err := fc.writeText(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (fc *framedConn) writeText(text []byte) error {
+	msg, ok := textNotification(fc.caps.tailor(text))
+	if !ok {
+		return nil
+	}
+	return fc.writeMessage(msg, nil)
+}
+
+func (fc *framedConn) writeMessage(msg Message, rendered []byte) error {
+	return fc.writeFrame(msg.ToJSON())
+}
+
+// writePrompt does nothing: framed clients draw their own prompt.
+func (fc *framedConn) writePrompt(prompt string) error {
+	return nil
+}
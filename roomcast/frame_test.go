@@ -0,0 +1,206 @@
+package roomcast
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// chunkReader returns its chunks one Read call at a time.
+type chunkReader struct {
+	chunks [][]byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	if r.chunks[0] = r.chunks[0][n:]; len(r.chunks[0]) == 0 {
+		r.chunks = r.chunks[1:]
+	}
+	return n, nil
+}
+
+func TestDecodeFrame(t *testing.T) {
+	frame := encodeFrame([]byte(`{"content":"hello"}`))
+	tests := []struct {
+		name    string
+		r       io.Reader
+		want    []string
+		wantErr []error
+	}{
+		{
+			name: "whole frame",
+			r:    bytes.NewReader(frame),
+			want: []string{`{"content":"hello"}`},
+		},
+		{
+			name: "split across two reads",
+			r:    &chunkReader{chunks: [][]byte{frame[:10], frame[10:]}},
+			want: []string{`{"content":"hello"}`},
+		},
+		{
+			name: "header split across two reads",
+			r:    &chunkReader{chunks: [][]byte{frame[:2], frame[2:]}},
+			want: []string{`{"content":"hello"}`},
+		},
+		{
+			name: "one byte per read",
+			r:    iotest.OneByteReader(bytes.NewReader(frame)),
+			want: []string{`{"content":"hello"}`},
+		},
+		{
+			name: "empty frame",
+			r:    bytes.NewReader(encodeFrame(nil)),
+			want: []string{""},
+		},
+		{
+			name:    "oversized frame is skipped",
+			r:       io.MultiReader(bytes.NewReader(encodeFrame(make([]byte, maxFrameSize+1))), bytes.NewReader(frame)),
+			want:    []string{"", `{"content":"hello"}`},
+			wantErr: []error{errFrameTooLarge, nil},
+		},
+		{
+			name:    "truncated frame",
+			r:       bytes.NewReader(frame[:len(frame)-1]),
+			want:    []string{""},
+			wantErr: []error{io.ErrUnexpectedEOF},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				var wantErr error
+				if tt.wantErr != nil {
+					wantErr = tt.wantErr[i]
+				}
+				got, err := decodeFrame(tt.r)
+				if !errors.Is(err, wantErr) {
+					t.Fatalf("frame %d: error = %v, want %v", i, err, wantErr)
+				}
+				if string(got) != want {
+					t.Errorf("frame %d = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+// framedTestClient is a client of a test server in framed mode.
+type framedTestClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+// joinFramed connects a framed client to server and answers the setup
+// prompts.
+func joinFramed(t *testing.T, server *Server, username, room string) *framedTestClient {
+	t.Helper()
+	c := &framedTestClient{t: t, conn: dial(t, server).conn}
+	c.expect("Enter username")
+	c.send(username)
+	c.expect("Enter room name")
+	c.send(room)
+	waitFor(t, username+" to join", func() bool {
+		r := server.Room(strings.ToUpper(room))
+		return r != nil && r.HasClient(username)
+	})
+	return c
+}
+
+// send sends content as a message frame.
+func (c *framedTestClient) send(content string) {
+	c.t.Helper()
+	c.write(encodeFrame(NewMessage(content, "", UserMessageType).ToJSON()))
+}
+
+// write writes raw bytes to the server.
+func (c *framedTestClient) write(b []byte) {
+	c.t.Helper()
+	if _, err := c.conn.Write(b); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+// expect reads frames until a message whose content contains want
+// arrives, and returns it.
+func (c *framedTestClient) expect(want string) Message {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(testTimeout))
+	for {
+		payload, err := decodeFrame(c.conn)
+		if err != nil {
+			c.t.Fatalf("waiting for %q: %v", want, err)
+		}
+		msg, err := FromJSON(payload)
+		if err != nil {
+			c.t.Fatalf("server sent an invalid frame %q: %v", payload, err)
+		}
+		if strings.Contains(msg.Content, want) {
+			return msg
+		}
+	}
+}
+
+func TestFramedProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		send     func(t *testing.T, bobby *framedTestClient)
+		wantCode string
+	}{
+		{
+			name: "frame split across two writes",
+			send: func(t *testing.T, bobby *framedTestClient) {
+				frame := encodeFrame(NewMessage("hello\nin two parts", "", UserMessageType).ToJSON())
+				bobby.write(frame[:7])
+				time.Sleep(50 * time.Millisecond)
+				bobby.write(frame[7:])
+			},
+		},
+		{
+			name: "oversized frame",
+			send: func(t *testing.T, bobby *framedTestClient) {
+				bobby.write(encodeFrame(make([]byte, maxFrameSize+1)))
+			},
+			wantCode: CodeTooLarge,
+		},
+		{
+			name: "frame without JSON",
+			send: func(t *testing.T, bobby *framedTestClient) {
+				bobby.write(encodeFrame([]byte("hello")))
+			},
+			wantCode: CodeUsage,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Protocol = protocolFramed
+			server := startServer(t, cfg)
+			alice := joinFramed(t, server, "alice", "room_one")
+			bobby := joinFramed(t, server, "bobby", "room_one")
+			alice.expect("bobby has joined the room")
+
+			tt.send(t, bobby)
+			if tt.wantCode != "" {
+				if msg := bobby.expect("Message rejected"); msg.Type != ErrorType || msg.Code != tt.wantCode {
+					t.Errorf("got %+v, want a %s error", msg, tt.wantCode)
+				}
+				// The connection stays usable.
+				bobby.send("hello again")
+				alice.expect("hello again")
+				return
+			}
+			msg := alice.expect("hello")
+			if msg.Content != "hello\nin two parts" || msg.Sender != "bobby" {
+				t.Errorf("got %+v, want bobby's message in one piece", msg)
+			}
+		})
+	}
+}
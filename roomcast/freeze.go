@@ -0,0 +1,46 @@
+package roomcast
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+func init() {
+	registerAdminCommand("freeze", freezeCommand)
+	registerAdminCommand("unfreeze", unfreezeCommand)
+}
+
+// freezeCommand handles "/freeze" (admin): nobody but admins can post
+// in the current room until it is unfrozen.
+func freezeCommand(c *Client, args []string) {
+	setFrozen(c, true, "🧊 %s froze the room, only admins can post until it is unfrozen.\n")
+}
+
+// unfreezeCommand handles "/unfreeze" (admin): everyone can post in the
+// current room again.
+func unfreezeCommand(c *Client, args []string) {
+	setFrozen(c, false, "🌊 %s unfroze the room, everyone can post again.\n")
+}
+
+// setFrozen freezes or unfreezes the client's current room and tells
+// its members with notice.
+func setFrozen(c *Client, frozen bool, notice string) {
+	room := c.currentRoom()
+	if room.frozen.Swap(frozen) == frozen {
+		state := "not frozen"
+		if frozen {
+			state = "already frozen"
+		}
+		c.writeError(CodeInvalidState, fmt.Sprintf("%s is %s.", room.name, state))
+		return
+	}
+	room.do(func() {
+		room.broadcast(&Message{
+			Content: fmt.Sprintf(notice, c.name()),
+			Sender:  c.name(),
+			Type:    NotificationType,
+			Room:    room.name,
+		}, nil)
+	})
+	slog.Info("🧊 Room frozen state changed", "user", c.name(), "room", room.name, "frozen", frozen)
+}
@@ -0,0 +1,371 @@
+package roomcast
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultHistoryPage is the number of messages /history shows when
+// no count is given.
+const defaultHistoryPage = 20
+
+func init() {
+	registerCommand("history", historyCommand)
+	registerCommand("clear", clearCommand)
+}
+
+// historyCommand handles "/history [n]", which shows the last n
+// messages of the current room. Only the messages kept in memory can
+// be shown, at most --history-limit.
+func historyCommand(c *Client, args []string) {
+	if len(args) > 0 && args[0] == "user" {
+		userHistoryCommand(c, args[1:])
+		return
+	}
+
+	n := defaultHistoryPage
+	if len(args) > 0 {
+		count, err := strconv.Atoi(args[0])
+		if err != nil || count < 1 {
+			c.writeError(CodeUsage, "Usage: /history [number of messages]")
+			return
+		}
+		n = count
+	}
+
+	room := c.currentRoom()
+	if !room.isLogged() {
+		c.writeMessage([]byte("🙈 Logging is disabled in this room, no history is kept.\n"))
+		return
+	}
+
+	history := room.history(0)
+	if len(history) == 0 {
+		c.writeMessage([]byte("📭 No chat history available.\n"))
+		return
+	}
+	shown := history[len(history)-min(n, len(history)):]
+
+	if err := c.writeMessage([]byte(fmt.Sprintf("📜 Last %d of %d messages in %s:\n", len(shown), len(history), room.name))); err != nil {
+		return
+	}
+	writeHistory(c, shown)
+}
+
+// userHistoryCommand handles "/history user <username> [n]" (admin):
+// it shows the last n messages the user sent in the current room, at
+// most maxHistory, searching the whole history file rather than only
+// the messages kept in memory.
+func userHistoryCommand(c *Client, args []string) {
+	if !requireAdmin(c) {
+		return
+	}
+	if len(args) < 1 || len(args) > 2 {
+		c.writeError(CodeUsage, "Usage: /history user <username> [number of messages]")
+		return
+	}
+	n := defaultHistoryPage
+	if len(args) == 2 {
+		count, err := strconv.Atoi(args[1])
+		if err != nil || count < 1 {
+			c.writeError(CodeUsage, "Usage: /history user <username> [number of messages]")
+			return
+		}
+		n = min(count, maxHistory)
+	}
+	username := strings.ToLower(args[0])
+
+	room := c.currentRoom()
+	sent, err := room.messagesBy(username, n)
+	if err != nil {
+		slog.Error("❌ Failed to search the history", "room", room.name, "sender", username, "err", err)
+		c.writeError(CodeInternal, "Failed to search the chat history.")
+		return
+	}
+	if len(sent) == 0 {
+		c.writeMessage([]byte(fmt.Sprintf("📭 No messages from %s in the history of %s.\n", username, room.name)))
+		return
+	}
+
+	if err := c.writeMessage([]byte(fmt.Sprintf("🔎 Last %d messages from %s in %s:\n", len(sent), username, room.name))); err != nil {
+		return
+	}
+	writeHistory(c, sent)
+}
+
+// messagesBy returns the last n messages sender posted in the room,
+// oldest first, read from its history file.
+func (r *Room) messagesBy(sender string, n int) ([]Message, error) {
+	r.historyMu.Lock()
+	lines, err := readHistoryLines(r.historyFile)
+	r.historyMu.Unlock()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sent []Message
+	for i := len(lines) - 1; i >= 0 && len(sent) < n; i-- {
+		msg, err := FromJSON([]byte(lines[i]))
+		if err == nil && msg.Sender == sender {
+			sent = append(sent, msg)
+		}
+	}
+	slices.Reverse(sent)
+	return sent, nil
+}
+
+// legacyMessagePattern matches the first line of a message saved as
+// text by older versions, once its colors are removed, e.g.
+// "⏳ [2024-05-01 10:00:00] #12 🤖 alice 💬 hello".
+var legacyMessagePattern = regexp.MustCompile(`^⏳ \[(\d{4}-\d\d-\d\d \d\d:\d\d:\d\d)\] (?:#\S+ )?🤖 (\S+) (?:💬 (.*)|📋 pasted:)$`)
+
+// clearCommand handles "/clear", which wipes the history of the
+// current room. Any member can run it for now; registering it with
+// registerAdminCommand instead would restrict it to admins.
+func clearCommand(c *Client, args []string) {
+	room := c.currentRoom()
+	if err := room.clearHistory(); err != nil {
+		slog.Error("❌ Error clearing history", "room", room.name, "err", err)
+		c.writeError(CodeInternal, "Failed to clear the chat history.")
+		return
+	}
+	slog.Info("🧹 History cleared", "user", c.name(), "room", room.name)
+
+	room.do(func() {
+		room.broadcast(&Message{
+			Content: "📢 Chat history was cleared.\n",
+			Type:    NotificationType,
+			Room:    room.name,
+		}, nil)
+	})
+}
+
+// clearHistory empties the history file and the recent messages of the
+// room. It runs on the room goroutine, so that no message is being
+// saved meanwhile. With a history queue, the history writer clears it,
+// discarding the messages still queued, so that none of them is saved
+// after the clear.
+func (r *Room) clearHistory() error {
+	err := errRoomClosed
+	r.do(func() {
+		if r.saves == nil {
+			err = r.truncateHistory()
+			return
+		}
+		cleared := make(chan error)
+		r.clears <- cleared
+		err = <-cleared
+	})
+	return err
+}
+
+// truncateHistory empties the history file and the recent messages of
+// the room. It holds r.historyMu and r.mu throughout, so no message is
+// saved halfway.
+func (r *Room) truncateHistory() error {
+	r.historyMu.Lock()
+	defer r.historyMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.Truncate(r.historyFile, 0); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	r.recent = nil
+	r.historyLines = 0
+	return nil
+}
+
+// readHistoryLines returns the lines of a history file.
+func readHistoryLines(name string) ([]string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxHistoryLine)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// writeHistoryLines replaces the content of a history file.
+func writeHistoryLines(name string, lines []string) error {
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+	}
+	return writeFileAtomic(name, []byte(b.String()))
+}
+
+// writeFileAtomic replaces the content of a file. It writes to a
+// temporary file first so that a crash never leaves a half-written
+// file behind.
+func writeFileAtomic(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// loadHistory counts the lines already in the history file and keeps
+// its last messages in memory, to be replayed to joining members.
+// Lines written before history was stored as JSON stay in the file but
+// aren't replayed.
+func (r *Room) loadHistory() {
+	lines, err := readHistoryLines(r.historyFile)
+	if err != nil && !os.IsNotExist(err) {
+		slog.Error("❌ Error reading history", "room", r.name, "err", err)
+	}
+	r.historyLines = len(lines)
+
+	if size := r.historySize(); len(lines) > size {
+		lines = lines[len(lines)-size:]
+	}
+	for _, line := range lines {
+		if msg, err := FromJSON([]byte(line)); err == nil {
+			r.recent = append(r.recent, msg)
+			r.seq = max(r.seq, msg.Seq)
+		}
+	}
+}
+
+// trimHistory keeps only the last Config.HistoryLimit lines of the
+// history file. Rewriting the file on every message would be costly,
+// so saveMessages only calls it once the file holds twice the limit,
+// and closeHistory when the room stops. r.historyMu must be held.
+func (r *Room) trimHistory() error {
+	lines, err := readHistoryLines(r.historyFile)
+	if err != nil {
+		return err
+	}
+	if limit := r.server.cfg.HistoryLimit; len(lines) > limit {
+		lines = lines[len(lines)-limit:]
+	}
+	if err := writeHistoryLines(r.historyFile, lines); err != nil {
+		return err
+	}
+	r.historyLines = len(lines)
+	return nil
+}
+
+// closeHistory trims the history file to Config.HistoryLimit once the
+// room has stopped, as it may hold up to twice as many lines while the
+// room runs.
+func (r *Room) closeHistory() {
+	r.historyMu.Lock()
+	defer r.historyMu.Unlock()
+
+	if limit := r.server.cfg.HistoryLimit; limit > 0 && r.historyLines > limit {
+		if err := r.trimHistory(); err != nil {
+			slog.Error("❌ Error trimming history", "room", r.name, "err", err)
+		}
+	}
+}
+
+// CleanHistory converts the history files saved as text by older
+// versions in dir to JSON lines, so they can be replayed again. Lines
+// that can't be parsed back into a message are kept as text, without
+// the color codes they used to be saved with. Lines already saved as
+// JSON are left untouched.
+func CleanHistory(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "history_*"))
+	if err != nil {
+		return err
+	}
+
+	for _, name := range files {
+		if ext := filepath.Ext(name); ext == ".ids" || ext == ".seq" || ext == ".topic" || ext == ".tmp" {
+			continue
+		}
+
+		lines, err := readHistoryLines(name)
+		if err != nil {
+			return err
+		}
+		converted := convertHistory(lines, historyRoom(name))
+		if slices.Equal(converted, lines) {
+			continue
+		}
+
+		if err := writeHistoryLines(name, converted); err != nil {
+			return err
+		}
+		slog.Info("🧹 Converted history to JSON lines", "file", name)
+	}
+	return nil
+}
+
+// convertHistory turns the text lines of a history file into JSON
+// messages of the given room where it can.
+func convertHistory(lines []string, room string) []string {
+	var converted []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "{") {
+			converted = append(converted, line)
+			continue
+		}
+
+		line = stripColors(line)
+		match := legacyMessagePattern.FindStringSubmatch(line)
+		if match == nil {
+			converted = append(converted, line)
+			continue
+		}
+		timestamp, err := time.ParseInLocation("2006-01-02 15:04:05", match[1], time.Local)
+		if err != nil {
+			converted = append(converted, line)
+			continue
+		}
+
+		msg := Message{Content: match[3], Sender: match[2], Timestamp: timestamp, Type: UserMessageType, Room: room}
+		if strings.HasSuffix(line, "📋 pasted:") {
+			// The pasted lines follow between "┌────" and "└────".
+			var pasted []string
+			j := i + 1
+			if j < len(lines) && stripColors(lines[j]) == "┌────" {
+				for j++; j < len(lines) && strings.HasPrefix(stripColors(lines[j]), "│ "); j++ {
+					pasted = append(pasted, strings.TrimPrefix(stripColors(lines[j]), "│ "))
+				}
+			}
+			if j >= len(lines) || stripColors(lines[j]) != "└────" {
+				converted = append(converted, line)
+				continue
+			}
+			msg.Type, msg.Content = PasteMessageType, strings.Join(pasted, "\n")
+			i = j
+		}
+		converted = append(converted, string(msg.ToJSON()))
+	}
+	return converted
+}
+
+// historyRoom returns the name of the room a history file belongs to,
+// undoing historyFileName.
+func historyRoom(name string) string {
+	room := strings.TrimPrefix(filepath.Base(name), "history_")
+	if encoded, ok := strings.CutPrefix(room, "~"); ok {
+		if decoded, err := hex.DecodeString(encoded); err == nil {
+			return string(decoded)
+		}
+	}
+	return room
+}
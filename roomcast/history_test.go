@@ -0,0 +1,476 @@
+package roomcast
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClearHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		queue    int
+		overflow string
+	}{
+		{name: "saved right away", queue: 0},
+		{name: "queue of one", queue: 1, overflow: overflowBlock},
+		{name: "large queue", queue: 256, overflow: overflowBlock},
+		{name: "dropping queue", queue: 4, overflow: overflowDrop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.HistoryQueue = tt.queue
+			if tt.overflow != "" {
+				cfg.HistoryOverflow = tt.overflow
+			}
+			server := startServer(t, cfg)
+			alice := join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_one")
+			alice.expect("bobby has joined the room")
+
+			for i := range 100 {
+				alice.send(fmt.Sprintf("before %d", i))
+			}
+			alice.send("/clear")
+			bobby.expect("Chat history was cleared")
+			alice.send("after")
+			bobby.expect("after")
+
+			server.mu.RLock()
+			room := server.rooms["ROOM_ONE"]
+			server.mu.RUnlock()
+			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+			defer cancel()
+			if err := server.Shutdown(ctx); err != nil {
+				t.Fatalf("Shutdown: %v", err)
+			}
+
+			lines, err := readHistoryLines(room.historyFile)
+			if err != nil {
+				t.Fatalf("reading the history: %v", err)
+			}
+			var contents []string
+			for _, line := range lines {
+				msg, err := FromJSON([]byte(line))
+				if err != nil {
+					t.Fatalf("history line %q: %v", line, err)
+				}
+				contents = append(contents, msg.Content)
+			}
+			if len(contents) != 1 || contents[0] != "after" {
+				t.Errorf("history after the clear = %q, want [after]", contents)
+			}
+		})
+	}
+}
+
+func TestHistoryOnJoin(t *testing.T) {
+	tests := []struct {
+		name    string
+		replay  bool
+		stored  []string
+		viaJoin bool
+		want    []string
+		refuted []string
+	}{
+		{
+			name:   "stored history",
+			replay: true,
+			stored: []string{"first", "second"},
+			want:   []string{"📜 Previous messages:", "💬 first", "💬 second"},
+		},
+		{
+			name:    "stored history on /join",
+			replay:  true,
+			stored:  []string{"first", "second"},
+			viaJoin: true,
+			want:    []string{"📜 Previous messages:", "💬 first", "💬 second"},
+		},
+		{
+			name:   "empty history",
+			replay: true,
+			want:   []string{"📭 No chat history available."},
+		},
+		{
+			name:    "replay turned off",
+			replay:  false,
+			stored:  []string{"first", "second"},
+			refuted: []string{"Previous messages", "first", "second", "No chat history"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.HistoryOnJoin = tt.replay
+			server := startServer(t, cfg)
+
+			var lines []byte
+			for _, content := range tt.stored {
+				lines = append(append(lines, NewMessage(content, "bobby", UserMessageType).ToJSON()...), '\n')
+			}
+			if err := os.WriteFile(historyPath(server.cfg.HistoryDir, "ROOM_ONE"), lines, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			var out string
+			if tt.viaJoin {
+				alice := join(t, server, "alice", "room_two")
+				alice.send("/join room_one")
+				out = alice.expect("ROOM_ONE" + ColorReset + " > ")
+			} else {
+				alice := dial(t, server)
+				alice.expect("Enter username: ")
+				alice.send("alice")
+				alice.expect("Enter room name: ")
+				alice.send("room_one")
+				out = alice.expect(" > ")
+			}
+
+			rest := out
+			for _, want := range tt.want {
+				i := strings.Index(rest, want)
+				if i < 0 {
+					t.Fatalf("%q missing or out of order in %q", want, out)
+				}
+				rest = rest[i+len(want):]
+			}
+			for _, refuted := range tt.refuted {
+				if strings.Contains(out, refuted) {
+					t.Errorf("unexpected %q in %q", refuted, out)
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       int
+		sent        int
+		firstKept   int
+		firstReplay int
+	}{
+		{name: "default limit", limit: maxHistory, sent: 150, firstKept: 50, firstReplay: 50},
+		{name: "small limit", limit: 10, sent: 25, firstKept: 15, firstReplay: 15},
+		{name: "below the limit", limit: 10, sent: 8, firstKept: 0, firstReplay: 0},
+		{name: "no limit", limit: 0, sent: 150, firstKept: 0, firstReplay: 150 - maxHistory},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.HistoryLimit = tt.limit
+			server := startServer(t, cfg)
+			alice := join(t, server, "alice", "room_one")
+			carol := join(t, server, "carol", "room_one")
+			for i := range tt.sent {
+				alice.send(fmt.Sprintf("message %03d", i))
+			}
+			carol.expect(fmt.Sprintf("💬 message %03d", tt.sent-1))
+
+			bobby := dial(t, server)
+			bobby.expect("Enter username: ")
+			bobby.send("bobby")
+			bobby.expect("Enter room name: ")
+			bobby.send("room_one")
+			replay := bobby.expect(" > ")
+			if want := fmt.Sprintf("message %03d", tt.firstReplay); !strings.Contains(replay, want) {
+				t.Errorf("replay misses %q", want)
+			}
+			if tt.firstReplay > 0 {
+				if dropped := fmt.Sprintf("message %03d", tt.firstReplay-1); strings.Contains(replay, dropped) {
+					t.Errorf("replay still has %q", dropped)
+				}
+			}
+
+			server.mu.RLock()
+			room := server.rooms["ROOM_ONE"]
+			server.mu.RUnlock()
+			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+			defer cancel()
+			if err := server.Shutdown(ctx); err != nil {
+				t.Fatalf("Shutdown: %v", err)
+			}
+
+			lines, err := readHistoryLines(room.historyFile)
+			if err != nil {
+				t.Fatalf("reading the history: %v", err)
+			}
+			if want := tt.sent - tt.firstKept; len(lines) != want {
+				t.Fatalf("history has %d lines, want %d", len(lines), want)
+			}
+			for i, line := range lines {
+				msg, err := FromJSON([]byte(line))
+				if err != nil {
+					t.Fatalf("history line %q: %v", line, err)
+				}
+				if want := fmt.Sprintf("message %03d", tt.firstKept+i); msg.Content != want {
+					t.Errorf("history line %d = %q, want %q", i, msg.Content, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecentMessages(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		sent  int
+		n     int
+		want  []int
+	}{
+		{name: "below the bound", limit: 3, sent: 2, want: []int{0, 1}},
+		{name: "at the bound", limit: 3, sent: 3, want: []int{0, 1, 2}},
+		{name: "wrapped around", limit: 3, sent: 5, want: []int{2, 3, 4}},
+		{name: "wrapped around twice", limit: 3, sent: 8, want: []int{5, 6, 7}},
+		{name: "last n", limit: 3, sent: 5, n: 2, want: []int{3, 4}},
+		{name: "more than kept", limit: 3, sent: 5, n: 10, want: []int{2, 3, 4}},
+		{name: "unbounded file", limit: 0, sent: maxHistory + 2, n: 2, want: []int{maxHistory, maxHistory + 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.HistoryLimit = tt.limit
+			server := startServer(t, cfg)
+			room, err := server.getOrCreateRoom("ROOM_ONE", "alice")
+			if err != nil {
+				t.Fatalf("getOrCreateRoom: %v", err)
+			}
+			for i := range tt.sent {
+				room.forward <- NewMessage(fmt.Sprintf("message %d", i), "alice", UserMessageType).ToJSON()
+			}
+			room.do(func() {})
+
+			check := func(when string, room *Room) {
+				t.Helper()
+				var got []int
+				for _, msg := range room.recentMessages(tt.n) {
+					var i int
+					fmt.Sscanf(msg.Content, "message %d", &i)
+					got = append(got, i)
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("%s: recentMessages(%d) = %v, want %v", when, tt.n, got, tt.want)
+				}
+			}
+			check("running", room)
+
+			// The buffer is filled from the history file on restart.
+			room.stop()
+			<-room.done
+			restarted, err := NewServer(server.cfg)
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			check("after a restart", newRoom("ROOM_ONE", restarted))
+		})
+	}
+}
+
+func TestCleanHistory(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	asJSON := func(msg Message) string { return string(msg.ToJSON()) }
+	const stamp = ColorWhiteText + "[2024-05-01 10:00:00]"
+
+	tests := []struct {
+		name   string
+		room   string
+		lines  []string
+		want   []string
+		replay string
+	}{
+		{
+			name:   "user message",
+			room:   "ROOM_ONE",
+			lines:  []string{"⏳ " + stamp + " #12 🤖 alice 💬 hello" + ColorReset},
+			want:   []string{asJSON(Message{Content: "hello", Sender: "alice", Timestamp: at, Type: UserMessageType, Room: "ROOM_ONE"})},
+			replay: "🤖 alice 💬 hello",
+		},
+		{
+			name: "paste",
+			room: "ROOM_ONE",
+			lines: []string{
+				"⏳ " + stamp + " 🤖 alice 📋 pasted:" + ColorReset,
+				"┌────",
+				"│ one",
+				"│ two",
+				"└────",
+			},
+			want:   []string{asJSON(Message{Content: "one\ntwo", Sender: "alice", Timestamp: at, Type: PasteMessageType, Room: "ROOM_ONE"})},
+			replay: "│ two",
+		},
+		{
+			name:  "unfinished paste",
+			room:  "ROOM_ONE",
+			lines: []string{"⏳ " + stamp + " 🤖 alice 📋 pasted:" + ColorReset, "┌────", "│ one"},
+			want:  []string{"⏳ [2024-05-01 10:00:00] 🤖 alice 📋 pasted:", "┌────", "│ one"},
+		},
+		{
+			name:  "notification kept as text",
+			room:  "ROOM_ONE",
+			lines: []string{ColorNotification + "📢 bobby has joined the room." + ColorReset},
+			want:  []string{"📢 bobby has joined the room."},
+		},
+		{
+			name:   "JSON left alone",
+			room:   "ROOM_ONE",
+			lines:  []string{asJSON(Message{Content: "hi", Sender: "bobby", Timestamp: at, Type: WhisperMessageType})},
+			want:   []string{asJSON(Message{Content: "hi", Sender: "bobby", Timestamp: at, Type: WhisperMessageType})},
+			replay: "(whisper from bobby): hi",
+		},
+		{
+			name:  "encoded room name",
+			room:  "SALON_É",
+			lines: []string{"⏳ " + stamp + " 🤖 alice 💬 salut" + ColorReset},
+			want:  []string{asJSON(Message{Content: "salut", Sender: "alice", Timestamp: at, Type: UserMessageType, Room: "SALON_É"})},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			dir := server.cfg.HistoryDir
+			file := historyPath(dir, tt.room)
+			if err := writeHistoryLines(file, tt.lines); err != nil {
+				t.Fatal(err)
+			}
+
+			// Cleaning twice converts once.
+			for range 2 {
+				if err := CleanHistory(dir); err != nil {
+					t.Fatalf("CleanHistory: %v", err)
+				}
+				got, err := readHistoryLines(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Fatalf("converted history:\n%q\nwant\n%q", got, tt.want)
+				}
+			}
+
+			if tt.replay != "" {
+				alice := dial(t, server)
+				if out := alice.setup("alice", strings.ToLower(tt.room)); !strings.Contains(out, tt.replay) {
+					t.Errorf("replay %q misses %q", out, tt.replay)
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		sent    int
+		command string
+		header  string
+		first   int
+	}{
+		{name: "last five", limit: maxHistory, sent: 8, command: "/history 5", header: "📜 Last 5 of 8 messages in ROOM_ONE:", first: 3},
+		{name: "default page", limit: maxHistory, sent: 25, command: "/history", header: "📜 Last 20 of 25 messages in ROOM_ONE:", first: 5},
+		{name: "more than sent", limit: maxHistory, sent: 3, command: "/history 10", header: "📜 Last 3 of 3 messages in ROOM_ONE:", first: 0},
+		{name: "capped by the limit", limit: 4, sent: 10, command: "/history 50", header: "📜 Last 4 of 4 messages in ROOM_ONE:", first: 6},
+		{name: "no history", limit: maxHistory, command: "/history 5", header: "📭 No chat history available."},
+		{name: "not a number", limit: maxHistory, sent: 2, command: "/history five", header: "Usage: /history [number of messages]"},
+		{name: "zero", limit: maxHistory, sent: 2, command: "/history 0", header: "Usage: /history [number of messages]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.HistoryLimit = tt.limit
+			server := startServer(t, cfg)
+			alice := join(t, server, "alice", "room_one")
+			carol := join(t, server, "carol", "room_one")
+			for i := range tt.sent {
+				alice.send(fmt.Sprintf("message %d", i))
+			}
+			if tt.sent > 0 {
+				carol.expect(fmt.Sprintf("💬 message %d", tt.sent-1))
+			}
+
+			alice.send(tt.command)
+			alice.expect(tt.header)
+			if !strings.HasPrefix(tt.header, "📜") {
+				alice.refute("💬 message", 200*time.Millisecond)
+				return
+			}
+			shown := alice.expect(fmt.Sprintf("💬 message %d", tt.sent-1))
+			if want := tt.sent - tt.first; strings.Count(shown, "💬 message") != want {
+				t.Errorf("%s showed %d messages, want %d:\n%s", tt.command, strings.Count(shown, "💬 message"), want, shown)
+			}
+			if want := fmt.Sprintf("💬 message %d", tt.first); !strings.Contains(shown, want) {
+				t.Errorf("%s misses %q:\n%s", tt.command, want, shown)
+			}
+		})
+	}
+}
+
+func TestClearCommand(t *testing.T) {
+	noReplay := func(t *testing.T, server *Server, alice *testClient) {
+		carol := dial(t, server)
+		out := carol.setup("carol", "room_one")
+		if !strings.Contains(out, "📭 No chat history available.") || strings.Contains(out, "before") {
+			t.Errorf("replay after /clear = %q, want no history", out)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		queue int
+		check func(t *testing.T, server *Server, alice *testClient)
+	}{
+		{
+			name:  "joining member",
+			check: noReplay,
+		},
+		{
+			name:  "joining member with a history queue",
+			queue: 16,
+			check: noReplay,
+		},
+		{
+			name: "/history",
+			check: func(t *testing.T, server *Server, alice *testClient) {
+				alice.send("/history")
+				alice.expect("📭 No chat history available.")
+			},
+		},
+		{
+			name: "history file",
+			check: func(t *testing.T, server *Server, alice *testClient) {
+				data, err := os.ReadFile(historyPath(server.cfg.HistoryDir, "ROOM_ONE"))
+				if err != nil {
+					t.Fatalf("reading the history: %v", err)
+				}
+				if len(data) != 0 {
+					t.Errorf("history file after /clear = %q, want it empty", data)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.HistoryQueue = tt.queue
+			server := startServer(t, cfg)
+			alice := join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_one")
+			for i := range 5 {
+				alice.send(fmt.Sprintf("before %d", i))
+			}
+			bobby.expect("💬 before 4")
+
+			alice.send("/clear")
+			bobby.expect("📢 Chat history was cleared.")
+			alice.expect("📢 Chat history was cleared.")
+			tt.check(t, server, alice)
+		})
+	}
+}
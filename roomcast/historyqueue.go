@@ -0,0 +1,90 @@
+package roomcast
+
+import "log/slog"
+
+// What happens to a message when the history queue of its room is full,
+// see Config.HistoryOverflow.
+const (
+	// overflowBlock makes the room wait for the history writer.
+	overflowBlock = "block"
+	// overflowDrop leaves the message out of the history file.
+	overflowDrop = "drop"
+)
+
+// save saves a forwarded message to the history file unless logging is
+// disabled. With Config.HistoryQueue set, the message is queued for the
+// history writer instead of being written right away. It must only be
+// called from the room goroutine.
+func (r *Room) save(msg Message) {
+	if !r.isLogged() {
+		return
+	}
+	if r.saves == nil {
+		r.saveMessages([]Message{msg})
+		return
+	}
+
+	if r.server.cfg.HistoryOverflow == overflowDrop {
+		select {
+		case r.saves <- msg:
+		default:
+			slog.Warn("⚠️ History queue full, message not saved", "room", r.name, "id", msg.ID)
+		}
+		return
+	}
+	r.saves <- msg
+}
+
+// historyWriter saves the messages queued by save, appending whatever
+// has piled up since the last write in one go, and clears the history
+// when asked on r.clears. It returns and closes r.saved once the room
+// closes r.saves and the last of them are saved.
+func (r *Room) historyWriter() {
+	defer close(r.saved)
+
+	for {
+		var msg Message
+		select {
+		case cleared := <-r.clears:
+			// The room waits for the clear, so nothing is queued
+			// meanwhile and what is left would be cleared anyway.
+			r.discardQueued()
+			cleared <- r.truncateHistory()
+			continue
+		case queued, ok := <-r.saves:
+			if !ok {
+				return
+			}
+			msg = queued
+		}
+
+		batch := []Message{msg}
+	queued:
+		for len(batch) < cap(r.saves) {
+			select {
+			case msg, ok := <-r.saves:
+				if !ok {
+					break queued
+				}
+				batch = append(batch, msg)
+			default:
+				break queued
+			}
+		}
+		r.saveMessages(batch)
+	}
+}
+
+// discardQueued drops the messages waiting in r.saves.
+func (r *Room) discardQueued() {
+	for {
+		select {
+		case _, ok := <-r.saves:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package roomcast
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// setIdleDeadline makes the next read fail once the client has gone
+// Config.IdleTimeout without sending a message. Commands don't count
+// as activity, so a client can't hold its room slots with /who alone.
+func (c *Client) setIdleDeadline() {
+	idle := c.server.cfg.IdleTimeout
+	if idle <= 0 {
+		return
+	}
+	c.conn.SetReadDeadline(time.Now().Add(idle - c.idleFor()))
+}
+
+// timeOut tells the client and its rooms that it is being disconnected
+// for inactivity. The read loop closes the client afterwards.
+func (c *Client) timeOut() {
+	slog.Info("⏰ Idle client timed out", "user", c.name(), "timeout", c.server.cfg.IdleTimeout)
+	c.writeMessage([]byte("\n"))
+	c.writeError(CodeTimeout, fmt.Sprintf("You have been disconnected after %v without sending a message.", c.server.cfg.IdleTimeout))
+
+	for _, room := range c.joinedRooms() {
+		room.do(func() {
+			room.broadcast(&Message{
+				Content: fmt.Sprintf("📢 %s timed out.\n", c.name()),
+				Sender:  c.name(),
+				Type:    NotificationType,
+				Room:    room.name,
+			}, c)
+		})
+	}
+}
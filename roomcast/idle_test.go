@@ -0,0 +1,51 @@
+package roomcast
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		every    string
+		timedOut bool
+	}{
+		{name: "silent client", timeout: 500 * time.Millisecond, timedOut: true},
+		{name: "messages reset the timer", timeout: 500 * time.Millisecond, every: "still here"},
+		{name: "commands don't count", timeout: 500 * time.Millisecond, every: "/who", timedOut: true},
+		{name: "disabled", timeout: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.IdleTimeout = tt.timeout
+			server := startServer(t, cfg)
+			alice := join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_one")
+			alice.expect("bobby has joined the room")
+
+			// Watch for 1.5s, three times the timeout.
+			for range 6 {
+				if tt.every != "" {
+					// Fails once alice is disconnected.
+					alice.conn.Write([]byte(tt.every + "\n"))
+				}
+				bobby.send("keeping bobby around")
+				time.Sleep(250 * time.Millisecond)
+			}
+
+			if tt.timedOut {
+				alice.expect("You have been disconnected after 500ms without sending a message.")
+				alice.expectClosed()
+				bobby.expect("alice timed out.")
+				bobby.expect("alice has left the room.")
+				return
+			}
+			bobby.refute("alice timed out", 100*time.Millisecond)
+			alice.send("/prompt")
+			alice.expect(" > ")
+		})
+	}
+}
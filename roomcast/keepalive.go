@@ -0,0 +1,88 @@
+package roomcast
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// maxMissedHeartbeats is the number of heartbeats in a row a client
+// may leave unanswered before it is considered gone.
+const maxMissedHeartbeats = 3
+
+// setKeepAlive enables TCP keepalive probes on conn with the given
+// period, so the kernel notices peers that vanished without closing
+// the connection. Other connections are left alone.
+func setKeepAlive(conn net.Conn, period time.Duration) {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok || period <= 0 {
+		return
+	}
+	tcp.SetKeepAlive(true)
+	tcp.SetKeepAlivePeriod(period)
+}
+
+// seen records that the client sent something, which answers the
+// heartbeats sent so far.
+func (c *Client) seen() {
+	c.lastSeen.Store(time.Now().UnixNano())
+}
+
+// drained records that write took a message off the client's queues.
+func (c *Client) drained() {
+	c.lastDrained.Store(time.Now().UnixNano())
+}
+
+// stuck reports whether the client has messages waiting but write
+// hasn't taken any of them for longer than timeout, which happens when
+// a write blocks on a peer that vanished without closing the connection.
+func (c *Client) stuck(timeout time.Duration) bool {
+	if len(c.send) == 0 && len(c.urgent) == 0 {
+		return false
+	}
+	return time.Since(time.Unix(0, c.lastDrained.Load())) > timeout
+}
+
+// dropStuckClients disconnects the members that are stuck for longer
+// than Config.DrainTimeout and tells the rest of the room they left.
+// It runs in the room goroutine.
+func (r *Room) dropStuckClients() {
+	var stuck []*Client
+	for client := range r.clients {
+		if client.stuck(r.server.cfg.DrainTimeout) {
+			slog.Warn("🧟 Queue not drained, disconnecting", "user", client.name(), "room", r.name, "timeout", r.server.cfg.DrainTimeout)
+			stuck = append(stuck, client)
+		}
+	}
+
+	r.dropClients(stuck)
+}
+
+// heartbeat sends a PING notification every Config.Heartbeat the client
+// stays silent, and closes the connection once maxMissedHeartbeats have
+// gone unanswered. Any input answers it, even an empty line. It returns
+// when the client is disconnected.
+func (c *Client) heartbeat() {
+	interval := c.server.cfg.Heartbeat
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		silent := time.Since(time.Unix(0, c.lastSeen.Load()))
+		switch {
+		case silent >= maxMissedHeartbeats*interval:
+			slog.Warn("💔 Missed heartbeats, disconnecting", "user", c.name(), "missed", maxMissedHeartbeats)
+			c.conn.Close()
+			return
+		case silent >= interval:
+			c.deliver(NewMessage(fmt.Sprintf("💓 PING: send anything within %v to stay connected.", (maxMissedHeartbeats*interval-silent).Round(time.Second)), "", NotificationType))
+		}
+	}
+}
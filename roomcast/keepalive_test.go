@@ -0,0 +1,77 @@
+package roomcast
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		answer   bool
+		dropped  bool
+	}{
+		{name: "silent client", interval: 200 * time.Millisecond, dropped: true},
+		{name: "empty lines answer", interval: 200 * time.Millisecond, answer: true},
+		{name: "disabled", interval: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Heartbeat = tt.interval
+			server := startServer(t, cfg)
+			alice := join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_one")
+
+			if tt.dropped {
+				alice.expect("💓 PING")
+				alice.expectClosed()
+				bobby.expect("alice has left the room.")
+				return
+			}
+			// Watch for 1.2s, twice the time it takes to be dropped.
+			deadline := time.Now().Add(1200 * time.Millisecond)
+			for time.Now().Before(deadline) {
+				if tt.answer {
+					alice.send("")
+				}
+				bobby.send("")
+				time.Sleep(50 * time.Millisecond)
+			}
+			bobby.refute("alice has left the room", 100*time.Millisecond)
+			if tt.interval == 0 {
+				alice.refute("PING", 100*time.Millisecond)
+			}
+			alice.send("/prompt")
+			alice.expect(" > ")
+		})
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	tests := []struct {
+		name    string
+		connect func(t *testing.T, server *Server) *testClient
+	}{
+		{name: "TCP", connect: dial},
+		{
+			name: "other transports are skipped",
+			connect: func(t *testing.T, server *Server) *testClient {
+				return pipe(t, server, func(c net.Conn) net.Conn { return c })
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.KeepAlivePeriod = time.Second
+			server := startServer(t, cfg)
+			alice := tt.connect(t, server)
+			alice.setup("alice", "room_one")
+			alice.send("/who")
+			alice.expect("1 user online in ROOM_ONE")
+		})
+	}
+}
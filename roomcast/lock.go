@@ -0,0 +1,209 @@
+package roomcast
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	registerCommand("lock", lockCommand)
+	registerCommand("unlock", unlockCommand)
+}
+
+// maxPasswordAttempts is how many wrong room passwords a client may
+// enter during setup before being disconnected, and an address may try
+// for a room, whichever way, before being refused it for
+// passwordLockout.
+const maxPasswordAttempts = 3
+
+// passwordLockout is how long an address that entered too many wrong
+// passwords for a room is refused it.
+const passwordLockout = time.Minute
+
+var (
+	errWrongPassword    = errors.New("wrong room password")
+	errTooManyPasswords = errors.New("too many wrong room passwords")
+)
+
+// passwordFailures counts the wrong passwords an address entered for a
+// room.
+type passwordFailures struct {
+	count int
+	last  time.Time
+}
+
+// roomLock is the bcrypt hash of the password of a locked room. The
+// password itself is never kept.
+type roomLock struct {
+	hash []byte
+}
+
+// newRoomLock hashes password. It fails with bcrypt.ErrPasswordTooLong
+// for passwords over 72 bytes, which bcrypt can't hash.
+func newRoomLock(password string) (*roomLock, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	return &roomLock{hash: hash}, nil
+}
+
+// opens reports whether password is the one the lock was made with.
+func (l *roomLock) opens(password string) bool {
+	return bcrypt.CompareHashAndPassword(l.hash, []byte(password)) == nil
+}
+
+// isLocked reports whether joining the room requires a password.
+func (r *Room) isLocked() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lock != nil
+}
+
+// checkPassword reports whether password lets a client into the room.
+// Any password does when the room isn't locked.
+func (r *Room) checkPassword(password string) bool {
+	r.mu.Lock()
+	lock := r.lock
+	r.mu.Unlock()
+	return lock == nil || lock.opens(password)
+}
+
+// tryPassword checks the password a client at ip entered for room, if
+// the room is locked. Every way of joining goes through it, so that an
+// address gets maxPasswordAttempts tries per passwordLockout in all,
+// and is refused with errTooManyPasswords, without paying for a bcrypt
+// comparison, once it has used them. An empty password is refused
+// without counting as a try.
+func (s *Server) tryPassword(room *Room, ip, password string) error {
+	if !room.isLocked() {
+		return nil
+	}
+	if password == "" {
+		return errWrongPassword
+	}
+
+	// The try is counted before the comparison, so concurrent ones
+	// can't go over the limit.
+	key := ip + "/" + room.name
+	now := time.Now()
+	s.mu.Lock()
+	for k, f := range s.passwordFailures {
+		if now.Sub(f.last) >= passwordLockout {
+			delete(s.passwordFailures, k)
+		}
+	}
+	failures := s.passwordFailures[key]
+	if failures.count >= maxPasswordAttempts {
+		s.mu.Unlock()
+		return errTooManyPasswords
+	}
+	s.passwordFailures[key] = passwordFailures{count: failures.count + 1, last: now}
+	s.mu.Unlock()
+
+	if !room.checkPassword(password) {
+		return errWrongPassword
+	}
+	s.mu.Lock()
+	delete(s.passwordFailures, key)
+	s.mu.Unlock()
+	return nil
+}
+
+// askRoomPassword asks a connecting client for the password of the
+// room it chose if the room is locked, giving it maxPasswordAttempts
+// tries before returning errWrongPassword.
+func (s *Server) askRoomPassword(conn net.Conn, reader *bufio.Reader, roomName string) error {
+	room := s.Room(roomName)
+	if room == nil || !room.isLocked() {
+		return nil
+	}
+
+	framed := isFramed(conn)
+	for attempt := 1; ; attempt++ {
+		conn.Write([]byte(fmt.Sprintf("🔒 %s is locked, enter its password: ", s.displayName(roomName))))
+		input, err := readLine(reader, framed)
+		if isFrameError(err) {
+			s.writeSetupError(conn, CodeUsage, fmt.Sprintf("Message rejected: %v.", err))
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error reading room password: %w", err)
+		}
+		err = s.tryPassword(room, remoteIP(conn), strings.TrimSpace(string(input)))
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, errTooManyPasswords) {
+			slog.Warn("🚨 Too many wrong room passwords", "room", roomName, "addr", conn.RemoteAddr())
+			s.writeSetupError(conn, CodeWrongPassword, fmt.Sprintf("Too many wrong passwords for %s, try again later.", roomName))
+			return err
+		}
+		if attempt == maxPasswordAttempts {
+			slog.Warn("🚨 Too many wrong room passwords", "room", roomName, "addr", conn.RemoteAddr())
+			s.writeSetupError(conn, CodeWrongPassword, fmt.Sprintf("Wrong password for %s, disconnecting.", roomName))
+			return errWrongPassword
+		}
+		s.writeSetupError(conn, CodeWrongPassword, "Wrong password, try again.")
+	}
+}
+
+// lockCommand handles "/lock <password>": the owner of the current
+// room, or an admin, makes joining it require the password.
+func lockCommand(c *Client, args []string) {
+	if len(args) != 1 {
+		c.writeError(CodeUsage, "Usage: /lock <password>")
+		return
+	}
+	lock, err := newRoomLock(args[0])
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		c.writeError(CodeTooLarge, "Password too long, at most 72 bytes.")
+		return
+	}
+	if err != nil {
+		slog.Error("❌ Error hashing the room password", "room", c.currentRoom().name, "err", err)
+		c.writeError(CodeInternal, "Could not lock the room, try again.")
+		return
+	}
+	setRoomLock(c, lock, "🔒 %s locked the room, newcomers need its password.\n")
+}
+
+// unlockCommand handles "/unlock": the owner of the current room, or
+// an admin, lets anyone join it again.
+func unlockCommand(c *Client, args []string) {
+	setRoomLock(c, nil, "🔓 %s unlocked the room.\n")
+}
+
+// setRoomLock replaces the lock of the client's current room if the
+// client owns the room or is an admin, and tells the members with notice.
+func setRoomLock(c *Client, lock *roomLock, notice string) {
+	room := c.currentRoom()
+	allowed := false
+	room.do(func() {
+		if room.owner != c && !c.isAdmin() {
+			return
+		}
+		allowed = true
+		room.mu.Lock()
+		room.lock = lock
+		room.mu.Unlock()
+		room.broadcast(&Message{
+			Content: fmt.Sprintf(notice, c.name()),
+			Sender:  c.name(),
+			Type:    NotificationType,
+			Room:    room.name,
+		}, nil)
+	})
+	if !allowed {
+		c.writeError(CodeForbidden, fmt.Sprintf("Only the owner of %s or an admin can change its lock.", room.name))
+		return
+	}
+	slog.Info("🔒 Room lock changed", "user", c.name(), "room", room.name, "locked", lock != nil)
+}
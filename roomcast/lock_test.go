@@ -0,0 +1,205 @@
+package roomcast
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRoomLock(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, server *Server, alice, bobby *testClient)
+	}{
+		{
+			name: "join without the password",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				bobby.send("/join room_one")
+				bobby.expect("ROOM_ONE is locked, use /join ROOM_ONE <password>.")
+			},
+		},
+		{
+			name: "join with a wrong password",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				bobby.send("/join room_one guess")
+				bobby.expect("Wrong password for ROOM_ONE.")
+			},
+		},
+		{
+			name: "join with the password",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				bobby.send("/join room_one s3cret")
+				bobby.expect("bobby 🏠 ROOM_ONE" + ColorReset + " > ")
+				alice.expect("bobby has joined the room")
+			},
+		},
+		{
+			name: "password asked at setup",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				carol := dial(t, server)
+				carol.expect("Enter username: ")
+				carol.send("carol")
+				carol.expect("Enter room name: ")
+				carol.send("room_one")
+				carol.expect("🔒 ROOM_ONE is locked, enter its password: ")
+				carol.send("guess")
+				carol.expect("Wrong password, try again.")
+				carol.expect("enter its password: ")
+				carol.send("s3cret")
+				carol.expect("carol 🏠 ROOM_ONE" + ColorReset + " > ")
+			},
+		},
+		{
+			name: "too many wrong passwords at setup",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				carol := dial(t, server)
+				carol.expect("Enter username: ")
+				carol.send("carol")
+				carol.expect("Enter room name: ")
+				carol.send("room_one")
+				for range maxPasswordAttempts {
+					carol.expect("enter its password: ")
+					carol.send("guess")
+				}
+				carol.expect("Wrong password for ROOM_ONE, disconnecting.")
+				carol.expectClosed()
+			},
+		},
+		{
+			name: "too many wrong passwords with /join",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				for range maxPasswordAttempts {
+					bobby.send("/join room_one guess")
+					bobby.expect("Wrong password for ROOM_ONE.")
+				}
+				bobby.send("/join room_one s3cret")
+				bobby.expect("Too many wrong passwords for ROOM_ONE, try again later.")
+				bobby.send("/switch room_one s3cret")
+				bobby.expect("Too many wrong passwords for ROOM_ONE, try again later.")
+
+				// Other addresses can still join.
+				carol := &testClient{t: t, conn: dialFrom(t, "127.0.0.2", server.Addr().String())}
+				carol.expect("Enter username: ")
+				carol.send("carol")
+				carol.expect("Enter room name: ")
+				carol.send("room_one")
+				carol.expect("enter its password: ")
+				carol.send("s3cret")
+				carol.expect("carol 🏠 ROOM_ONE" + ColorReset + " > ")
+			},
+		},
+		{
+			name: "wrong passwords count whichever way they are tried",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				carol := dial(t, server)
+				carol.expect("Enter username: ")
+				carol.send("carol")
+				carol.expect("Enter room name: ")
+				carol.send("room_one")
+				for range maxPasswordAttempts {
+					carol.expect("enter its password: ")
+					carol.send("guess")
+				}
+				carol.expectClosed()
+
+				bobby.send("/join room_one s3cret")
+				bobby.expect("Too many wrong passwords for ROOM_ONE, try again later.")
+
+				gateway := httptest.NewServer(http.HandlerFunc(server.handleWebSocket))
+				t.Cleanup(gateway.Close)
+				upgrade := func(password string) int {
+					t.Helper()
+					req, err := http.NewRequest("GET", gateway.URL+"/?username=dave_&room=room_one&password="+password, nil)
+					if err != nil {
+						t.Fatal(err)
+					}
+					req.Header.Set("Connection", "Upgrade")
+					req.Header.Set("Upgrade", "websocket")
+					req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+					req.Header.Set("Sec-WebSocket-Version", "13")
+					resp, err := http.DefaultClient.Do(req)
+					if err != nil {
+						t.Fatalf("request: %v", err)
+					}
+					resp.Body.Close()
+					return resp.StatusCode
+				}
+				for range maxPasswordAttempts {
+					if status := upgrade("guess"); status != http.StatusForbidden {
+						t.Fatalf("status = %d, want 403", status)
+					}
+				}
+				if status := upgrade("s3cret"); status != http.StatusTooManyRequests {
+					t.Fatalf("status = %d, want 429", status)
+				}
+
+				// The gateway listens on 127.0.0.1, erin connects from there too.
+				erin := &testClient{t: t, conn: dialFrom(t, "127.0.0.1", server.Addr().String())}
+				erin.expect("Enter username: ")
+				erin.send("erin_")
+				erin.expect("Enter room name: ")
+				erin.send("room_one")
+				erin.expect("enter its password: ")
+				erin.send("s3cret")
+				erin.expect("Too many wrong passwords for ROOM_ONE, try again later.")
+				erin.expectClosed()
+			},
+		},
+		{
+			name: "unlock",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				alice.send("/unlock")
+				alice.expect("alice unlocked the room.")
+				bobby.send("/join room_one")
+				bobby.expect("bobby 🏠 ROOM_ONE" + ColorReset + " > ")
+			},
+		},
+		{
+			name: "only the owner can change the lock",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				bobby.send("/join room_one s3cret")
+				bobby.expect("bobby 🏠 ROOM_ONE" + ColorReset + " > ")
+				bobby.send("/unlock")
+				bobby.expect("Only the owner of ROOM_ONE or an admin can change its lock.")
+			},
+		},
+		{
+			name: "password too long",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				alice.send("/lock " + strings.Repeat("x", 73))
+				alice.expect("Password too long, at most 72 bytes.")
+				bobby.send("/join room_one s3cret")
+				bobby.expect("bobby 🏠 ROOM_ONE" + ColorReset + " > ")
+			},
+		},
+		{
+			name: "only a bcrypt hash is kept",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				room := server.Room("ROOM_ONE")
+				room.mu.Lock()
+				lock := room.lock
+				room.mu.Unlock()
+				if strings.Contains(string(lock.hash), "s3cret") {
+					t.Errorf("the lock keeps the password: %q", lock.hash)
+				}
+				if cost, err := bcrypt.Cost(lock.hash); err != nil || cost != bcrypt.DefaultCost {
+					t.Errorf("bcrypt.Cost = %d, %v, want %d", cost, err, bcrypt.DefaultCost)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			alice := join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_two")
+			alice.send("/lock s3cret")
+			alice.expect("alice locked the room")
+
+			tt.run(t, server, alice, bobby)
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package roomcast
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	NotificationType   = "Notification"
+	UserMessageType    = "UserMessage"
+	PrivateMessageType = "PrivateMessage"
+	PasteMessageType   = "Paste"
+	WhisperMessageType = "Whisper"
+	ErrorType          = "Error"
+
+	// DeleteType tells clients to remove the message whose ID is
+	// the content, e.g. an expired timed message.
+	DeleteType = "Delete"
+)
+
+// urlPattern finds links in user messages so they can be highlighted.
+var urlPattern = regexp.MustCompile(`https?://[^\s]+`)
+
+// Message represents a chat message exchanged over TCP.
+type Message struct {
+	ID        string    `json:"id,omitempty"`
+	Content   string    `json:"content"`
+	Sender    string    `json:"sender"`
+	Timestamp time.Time `json:"timestamp"`
+	Type      string    `json:"type"`
+	Room      string    `json:"room,omitempty"`
+
+	// Seq numbers the messages forwarded in a room, without gaps, so
+	// clients can tell when they missed some and ask for a /catchup.
+	Seq uint64 `json:"seq,omitempty"`
+
+	// Expires is when a timed message is deleted, zero for others.
+	Expires time.Time `json:"expires,omitzero"`
+
+	// Code is the machine-readable code of an error message.
+	Code string `json:"code,omitempty"`
+
+	// Origin is the peer server a federated message came from,
+	// empty for messages posted on this server.
+	Origin string `json:"origin,omitempty"`
+}
+
+// NewMessage creates a new Message instance.
+func NewMessage(content, sender, msgType string) Message {
+	return Message{
+		Content:   content,
+		Sender:    sender,
+		Timestamp: time.Now(),
+		Type:      msgType,
+	}
+}
+
+// Line spacing policies, chosen with --line-spacing.
+const (
+	// spacingCompact shows every message right under the previous one.
+	spacingCompact = "compact"
+
+	// spacingSpaced leaves a blank line between messages.
+	spacingSpaced = "spaced"
+)
+
+// textStyle holds the display settings of a server: its line spacing
+// policy and the number of characters of names shown, zero showing them
+// in full.
+type textStyle struct {
+	spacing   string
+	nameWidth int
+}
+
+// formatAndConvertToBytes formats the message with colors, laid out as
+// a block of output. Messages arrive while the prompt is shown, except
+// errors, written in reply to the line the client just entered.
+func (m Message) formatAndConvertToBytes(style textStyle) []byte {
+	return style.layout(m.format(style), m.Type != ErrorType)
+}
+
+// layout turns formatted text into a block of output. It is the only
+// place deciding where newlines go: the block ends with exactly one
+// newline, and starts with one when afterPrompt is set so that it
+// doesn't follow the prompt on the same line. The spaced policy adds a
+// blank line before it.
+func (style textStyle) layout(text string, afterPrompt bool) []byte {
+	var b strings.Builder
+	if afterPrompt {
+		b.WriteString("\n")
+	}
+	if style.spacing == spacingSpaced {
+		b.WriteString("\n")
+	}
+	b.WriteString(text)
+	b.WriteString("\n")
+	return []byte(b.String())
+}
+
+// format formats the message with colors, without leading or trailing
+// newlines.
+func (m Message) format(style textStyle) string {
+	content := strings.Trim(m.Content, "\n")
+	timestamp := m.Timestamp.Format("2006-01-02 15:04:05")
+
+	switch m.Type {
+	case NotificationType:
+		return fmt.Sprintf("%s%s%s", ColorNotification, content, ColorReset)
+
+	case ErrorType:
+		return fmt.Sprintf("%s❌ %s [%s]%s", ColorError, content, m.Code, ColorReset)
+
+	case DeleteType:
+		return fmt.Sprintf("%s🕒 Message #%s has expired.%s", ColorNotification, shortID(content), ColorReset)
+
+	case PrivateMessageType:
+		return fmt.Sprintf("🔒 %s[%s] (private from %s): %s%s",
+			ColorWhiteText, timestamp, shortenName(m.Sender, style.nameWidth), content, ColorReset,
+		)
+
+	case WhisperMessageType:
+		return fmt.Sprintf("🔒 %s[%s] (whisper from %s): %s%s",
+			ColorWhiteText, timestamp, shortenName(m.Sender, style.nameWidth), content, ColorReset,
+		)
+	}
+
+	id := ""
+	if m.ID != "" {
+		id = "#" + shortID(m.ID) + " "
+	}
+
+	if m.Type == PasteMessageType {
+		var b strings.Builder
+		fmt.Fprintf(&b, "⏳ %s[%s] %s🤖 %s 📋 pasted:%s\n",
+			ColorWhiteText, timestamp, id, shortenName(m.Sender, style.nameWidth), ColorReset,
+		)
+		b.WriteString("┌────\n")
+		for _, line := range strings.Split(content, "\n") {
+			fmt.Fprintf(&b, "│ %s\n", line)
+		}
+		b.WriteString("└────")
+		return b.String()
+	}
+
+	content = urlPattern.ReplaceAllString(content, ColorLink+"$0"+ColorReset+ColorWhiteText)
+	if !m.Expires.IsZero() {
+		content += fmt.Sprintf(" 🕒 until %s", m.Expires.Format("15:04:05"))
+	}
+
+	return fmt.Sprintf("⏳ %s[%s] %s🤖 %s 💬 %s%s",
+		ColorWhiteText, timestamp, id, shortenName(m.Sender, style.nameWidth), content, ColorReset,
+	)
+}
+
+// ToJSON converts the message to a JSON byte array.
+func (m Message) ToJSON() []byte {
+	jsonData, err := json.Marshal(m)
+	if err != nil {
+		slog.Error("❌ Error encoding message to JSON", "err", err)
+		return nil
+	}
+	return jsonData
+}
+
+// FromJSON decodes the JSON byte array into a Message struct.
+// Messages without a type are treated as user messages; unknown
+// types are rejected so that malformed input never reaches a room.
+func FromJSON(jsonData []byte) (Message, error) {
+	var msg Message
+	err := json.Unmarshal(jsonData, &msg)
+	if err != nil {
+		return Message{}, fmt.Errorf("❌ Error decoding JSON: %v", err)
+	}
+
+	switch msg.Type {
+	case "":
+		msg.Type = UserMessageType
+	case UserMessageType, NotificationType, PrivateMessageType, PasteMessageType, WhisperMessageType, ErrorType, DeleteType:
+	default:
+		return Message{}, fmt.Errorf("❌ Unknown message type: %q", msg.Type)
+	}
+
+	return msg, nil
+}
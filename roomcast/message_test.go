@@ -0,0 +1,145 @@
+package roomcast
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFormatAndConvertToBytes(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	message := func(content, msgType string) Message {
+		return Message{Content: content, Sender: "alice", Timestamp: at, Type: msgType}
+	}
+	const stamp = ColorWhiteText + "[2024-05-01 10:00:00]"
+
+	tests := []struct {
+		name    string
+		spacing string
+		msg     Message
+		want    string
+	}{
+		{
+			name: "user message",
+			msg:  message("hello", UserMessageType),
+			want: "\n⏳ " + stamp + " 🤖 alice 💬 hello" + ColorReset + "\n",
+		},
+		{
+			name: "user message with an ID",
+			msg:  Message{ID: "srv:2a", Content: "hello", Sender: "alice", Timestamp: at, Type: UserMessageType},
+			want: "\n⏳ " + stamp + " #2a 🤖 alice 💬 hello" + ColorReset + "\n",
+		},
+		{
+			name: "stray newlines are trimmed",
+			msg:  message("\nhello\n\n", UserMessageType),
+			want: "\n⏳ " + stamp + " 🤖 alice 💬 hello" + ColorReset + "\n",
+		},
+		{
+			name: "notification",
+			msg:  message("📢 bobby has joined the room.\n", NotificationType),
+			want: "\n" + ColorNotification + "📢 bobby has joined the room." + ColorReset + "\n",
+		},
+		{
+			name: "private message",
+			msg:  message("psst", PrivateMessageType),
+			want: "\n🔒 " + stamp + " (private from alice): psst" + ColorReset + "\n",
+		},
+		{
+			name: "whisper",
+			msg:  message("psst", WhisperMessageType),
+			want: "\n🔒 " + stamp + " (whisper from alice): psst" + ColorReset + "\n",
+		},
+		{
+			name: "paste",
+			msg:  message("one\ntwo", PasteMessageType),
+			want: "\n⏳ " + stamp + " 🤖 alice 📋 pasted:" + ColorReset + "\n┌────\n│ one\n│ two\n└────\n",
+		},
+		{
+			name: "delete",
+			msg:  message("srv:2a", DeleteType),
+			want: "\n" + ColorNotification + "🕒 Message #2a has expired." + ColorReset + "\n",
+		},
+		{
+			name: "error doesn't follow the prompt",
+			msg:  Message{Content: "Room is full.", Type: ErrorType, Code: CodeRoomFull},
+			want: ColorError + "❌ Room is full. [" + CodeRoomFull + "]" + ColorReset + "\n",
+		},
+		{
+			name:    "spaced user message",
+			spacing: spacingSpaced,
+			msg:     message("hello", UserMessageType),
+			want:    "\n\n⏳ " + stamp + " 🤖 alice 💬 hello" + ColorReset + "\n",
+		},
+		{
+			name:    "spaced notification",
+			spacing: spacingSpaced,
+			msg:     message("📢 bobby has joined the room.", NotificationType),
+			want:    "\n\n" + ColorNotification + "📢 bobby has joined the room." + ColorReset + "\n",
+		},
+		{
+			name:    "spaced error",
+			spacing: spacingSpaced,
+			msg:     Message{Content: "Room is full.", Type: ErrorType, Code: CodeRoomFull},
+			want:    "\n" + ColorError + "❌ Room is full. [" + CodeRoomFull + "]" + ColorReset + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.HistoryDir = t.TempDir()
+			if tt.spacing != "" {
+				cfg.LineSpacing = tt.spacing
+			}
+			server, err := NewServer(cfg)
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+
+			if got := string(tt.msg.formatAndConvertToBytes(server.style)); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzFromJSON(f *testing.F) {
+	seeds := []string{
+		`{"content":"hello","sender":"alice","timestamp":"2024-05-01T10:00:00Z","type":"UserMessage","room":"LOBBY"}`,
+		`{"content":"hello"}`,
+		`{"id":"0123456789abcdef","content":"line one\nline two","sender":"bob","timestamp":"2024-05-01T10:00:00.123456789+02:00","type":"Paste","seq":42}`,
+		`{"content":"gone","type":"UserMessage","expires":"2024-05-01T10:05:00Z"}`,
+		`{"content":"Room is full.","type":"Error","code":"ROOM_FULL"}`,
+		`{"content":"hi","sender":"carol","type":"Whisper","origin":"peer:9000"}`,
+		`{"content":"x","type":"Bogus"}`,
+		`{"content":"x","type":7}`,
+		`{"timestamp":"yesterday"}`,
+		`{"seq":-1}`,
+		`{"content":"unterminated`,
+		`[1,2,3]`,
+		`null`,
+		``,
+		`not json at all`,
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := FromJSON(data)
+		if err != nil {
+			return
+		}
+
+		encoded := msg.ToJSON()
+		if encoded == nil {
+			t.Fatalf("ToJSON failed for a message FromJSON accepted: %q", data)
+		}
+		decoded, err := FromJSON(encoded)
+		if err != nil {
+			t.Fatalf("FromJSON(%q) after a round trip: %v", encoded, err)
+		}
+		if again := decoded.ToJSON(); !bytes.Equal(again, encoded) {
+			t.Fatalf("round trip changed the message:\n%s\n%s", encoded, again)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package roomcast
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics holds the Prometheus metrics of a server. Each server has its
+// own registry, so that several servers can run in the same process.
+type metrics struct {
+	registry *prometheus.Registry
+
+	connections prometheus.Counter
+	clients     prometheus.Gauge
+	rooms       prometheus.Gauge
+	forwarded   prometheus.Counter
+	dropped     prometheus.Counter
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		connections: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "roomcast_connections_total",
+			Help: "Connections accepted since startup.",
+		}),
+		clients: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "roomcast_clients",
+			Help: "Clients currently connected.",
+		}),
+		rooms: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "roomcast_rooms",
+			Help: "Rooms currently open.",
+		}),
+		forwarded: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "roomcast_messages_forwarded_total",
+			Help: "Messages forwarded by all rooms.",
+		}),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "roomcast_messages_dropped_total",
+			Help: "Messages not delivered because the client was too slow.",
+		}),
+	}
+	m.registry.MustRegister(m.connections, m.clients, m.rooms, m.forwarded, m.dropped)
+	return m
+}
+
+// startMetrics serves Prometheus metrics on Config.MetricsAddr, if set.
+func (s *Server) startMetrics() error {
+	if s.cfg.MetricsAddr == "" {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", s.cfg.MetricsAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for metrics requests: %w", err)
+	}
+	s.mu.Lock()
+	s.metricsListener = ln
+	s.mu.Unlock()
+	slog.Info("📈 Serving metrics", "addr", s.cfg.MetricsAddr)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", s.metricsHandler())
+	httpServer := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go httpServer.Serve(ln)
+	return nil
+}
+
+// metricsHandler serves the metrics of the server's registry, as
+// promhttp.Handler does for the default one.
+func (s *Server) metricsHandler() http.Handler {
+	return promhttp.InstrumentMetricHandler(s.metrics.registry,
+		promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{}))
+}
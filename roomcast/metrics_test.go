@@ -0,0 +1,119 @@
+package roomcast
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, server *Server)
+		want map[string]float64
+	}{
+		{
+			name: "idle",
+			run:  func(t *testing.T, server *Server) {},
+			want: map[string]float64{"connections_total": 0, "clients": 0, "rooms": 0, "messages_forwarded_total": 0},
+		},
+		{
+			name: "broadcast",
+			run: func(t *testing.T, server *Server) {
+				alice := join(t, server, "alice", "room_one")
+				bobby := join(t, server, "bobby", "room_one")
+				alice.send("hello")
+				bobby.expect("💬 hello")
+			},
+			want: map[string]float64{"connections_total": 2, "clients": 2, "rooms": 1, "messages_forwarded_total": 1},
+		},
+		{
+			name: "two rooms",
+			run: func(t *testing.T, server *Server) {
+				join(t, server, "alice", "room_one")
+				join(t, server, "bobby", "room_two")
+			},
+			want: map[string]float64{"connections_total": 2, "clients": 2, "rooms": 2},
+		},
+		{
+			name: "client leaves",
+			run: func(t *testing.T, server *Server) {
+				join(t, server, "alice", "room_one")
+				bobby := join(t, server, "bobby", "room_one")
+				bobby.send("/quit")
+				bobby.expectClosed()
+				waitFor(t, "bobby to be removed", func() bool { return server.Stats().Clients == 1 })
+			},
+			want: map[string]float64{"connections_total": 2, "clients": 1, "rooms": 1},
+		},
+		{
+			name: "slow client",
+			run: func(t *testing.T, server *Server) {
+				slow := pipe(t, server, func(conn net.Conn) net.Conn { return conn })
+				slow.setup("slowy", "room_one")
+				room := server.Room("ROOM_ONE")
+				// slowy stops reading, so its queue fills up and the
+				// next message is dropped.
+				for i := range messageBufferSize + 2 {
+					room.forward <- NewMessage(fmt.Sprintf("message %d", i), "alice", UserMessageType).ToJSON()
+				}
+				room.do(func() {})
+			},
+			want: map[string]float64{"connections_total": 1, "rooms": 1, "messages_dropped_total": 1},
+		},
+		{
+			name: "shutdown",
+			run: func(t *testing.T, server *Server) {
+				join(t, server, "alice", "room_one")
+				join(t, server, "bobby", "room_two")
+				ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+				defer cancel()
+				if err := server.Shutdown(ctx); err != nil {
+					t.Fatalf("Shutdown: %v", err)
+				}
+			},
+			want: map[string]float64{"connections_total": 2, "rooms": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			tt.run(t, server)
+
+			collectors := map[string]prometheus.Collector{
+				"connections_total":        server.metrics.connections,
+				"clients":                  server.metrics.clients,
+				"rooms":                    server.metrics.rooms,
+				"messages_forwarded_total": server.metrics.forwarded,
+				"messages_dropped_total":   server.metrics.dropped,
+			}
+			for name, want := range tt.want {
+				if got := testutil.ToFloat64(collectors[name]); got != want {
+					t.Errorf("roomcast_%s = %v, want %v", name, got, want)
+				}
+			}
+
+			endpoint := httptest.NewServer(server.metricsHandler())
+			t.Cleanup(endpoint.Close)
+			resp, err := http.Get(endpoint.URL)
+			if err != nil {
+				t.Fatalf("scraping the metrics: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			for name, want := range tt.want {
+				if line := fmt.Sprintf("roomcast_%s %v\n", name, want); !strings.Contains(string(body), line) {
+					t.Errorf("scrape misses %q:\n%s", line, body)
+				}
+			}
+		})
+	}
+}
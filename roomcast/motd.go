@@ -0,0 +1,49 @@
+package roomcast
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// maxMotdLength is the maximum number of characters in a room's message of the day.
+const maxMotdLength = 300
+
+func init() {
+	registerAdminCommand("setmotd", setMotdCommand)
+}
+
+// sendMotd shows the message of the day of the room to a client that
+// just joined it: the room's own if an admin set one, the server's
+// otherwise.
+func (r *Room) sendMotd(client *Client) {
+	r.mu.Lock()
+	motd := r.motd
+	r.mu.Unlock()
+
+	if motd == "" {
+		motd = r.server.cfg.Motd
+	}
+	if motd == "" {
+		return
+	}
+	client.writeMessage([]byte(fmt.Sprintf("📌 %s\n", motd)))
+}
+
+// setMotdCommand handles "/setmotd [text]" (admin): it sets the message
+// of the day of the current room, or goes back to the server's one.
+func setMotdCommand(c *Client, args []string) {
+	room := c.currentRoom()
+	motd := sanitizeText(strings.Join(args, " "), maxMotdLength)
+
+	room.mu.Lock()
+	room.motd = motd
+	room.mu.Unlock()
+
+	slog.Info("📌 Message of the day set", "user", c.name(), "room", room.name, "motd", motd)
+	if motd == "" {
+		c.writeMessage([]byte(fmt.Sprintf("📌 %s now uses the server's message of the day.\n", room.name)))
+		return
+	}
+	c.writeMessage([]byte(fmt.Sprintf("📌 Message of the day of %s set to: %s\n", room.name, motd)))
+}
@@ -0,0 +1,110 @@
+package roomcast
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// idBlockSize is the number of message IDs a room reserves on disk at
+// a time. After a restart the room continues after the last reserved
+// block, so IDs never collide with those already in its history even
+// though some numbers are skipped.
+const idBlockSize = 100
+
+// messageID builds the ID of the n-th message of a room, e.g. "LOBBY:42".
+// IDs are unique across rooms and restarts.
+func messageID(room string, n int) string {
+	return fmt.Sprintf("%s:%d", room, n)
+}
+
+// shortID returns the per-room part of a message ID, as shown to users.
+func shortID(id string) string {
+	if i := strings.LastIndexByte(id, ':'); i >= 0 {
+		return id[i+1:]
+	}
+	return id
+}
+
+// idFile is the file in which the room reserves message IDs.
+func (r *Room) idFile() string {
+	return r.historyFile + ".ids"
+}
+
+// loadIDs restores the message counter reserved by a previous run.
+func (r *Room) loadIDs() {
+	data, err := os.ReadFile(r.idFile())
+	if err != nil {
+		return
+	}
+
+	reserved, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		slog.Error("❌ Invalid message ID file", "room", r.name, "err", err)
+		return
+	}
+	r.lastID, r.reservedID = reserved, reserved
+}
+
+// nextID returns the ID of the next forwarded message, reserving a new
+// block on disk when the current one is used up. It must only be
+// called from the room goroutine.
+func (r *Room) nextID() string {
+	r.lastID++
+	if r.lastID > r.reservedID {
+		r.reservedID = r.lastID + idBlockSize - 1
+		if err := os.WriteFile(r.idFile(), []byte(strconv.Itoa(r.reservedID)), 0644); err != nil {
+			slog.Error("❌ Error reserving message IDs", "room", r.name, "err", err)
+		}
+	}
+	return messageID(r.name, r.lastID)
+}
+
+// seqFile is the file holding the sequence number of the room's last
+// message. Unlike the history file, it is neither emptied by /clear nor
+// missing the messages sent while logging was off or dropped when the
+// history queue overflowed.
+func (r *Room) seqFile() string {
+	return r.historyFile + ".seq"
+}
+
+// loadSeq restores the sequence number saved by a previous run. It is
+// called once the history is loaded, and never takes the number back
+// if the history holds later messages, e.g. when the file couldn't be
+// written.
+func (r *Room) loadSeq() {
+	data, err := os.ReadFile(r.seqFile())
+	if err != nil {
+		return
+	}
+
+	seq, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		slog.Error("❌ Invalid sequence number file", "room", r.name, "err", err)
+		return
+	}
+	r.seq = max(r.seq, seq)
+}
+
+// nextSeq returns the sequence number of the next forwarded message. It
+// must only be called from the room goroutine.
+func (r *Room) nextSeq() uint64 {
+	r.seq++
+	return r.seq
+}
+
+// saveSeq saves the sequence number of the last message, so numbering
+// continues without gaps after a restart. It is called when the room
+// stops and on /flush rather than for every message; after a crash, the
+// number is recovered from the history. It must only be called from the
+// room goroutine.
+func (r *Room) saveSeq() {
+	if r.seq == 0 {
+		return
+	}
+	if err := writeFileAtomic(r.seqFile(), []byte(strconv.FormatUint(r.seq, 10))); err != nil {
+		slog.Error("❌ Error saving the sequence number", "room", r.name, "err", err)
+	}
+}
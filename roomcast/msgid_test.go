@@ -0,0 +1,125 @@
+package roomcast
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestSeqContinuesAfterRestart(t *testing.T) {
+	tests := []struct {
+		name   string
+		before func(r *Room)
+		after  func(t *testing.T, r *Room)
+	}{
+		{name: "plain restart"},
+		{
+			name: "history cleared",
+			after: func(t *testing.T, r *Room) {
+				if err := r.clearHistory(); err != nil {
+					t.Fatalf("clearHistory: %v", err)
+				}
+			},
+		},
+		{
+			name: "logging off",
+			before: func(r *Room) {
+				r.mu.Lock()
+				r.persist = false
+				r.mu.Unlock()
+			},
+		},
+		{
+			name: "history file lost",
+			after: func(t *testing.T, r *Room) {
+				if err := os.Remove(r.historyFile); err != nil {
+					t.Fatalf("removing the history: %v", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.HistoryDir = t.TempDir()
+			open := func() *Room {
+				server, err := NewServer(cfg)
+				if err != nil {
+					t.Fatalf("NewServer: %v", err)
+				}
+				room := newRoom("ROOM_ONE", server)
+				go room.run()
+				t.Cleanup(room.stop)
+				return room
+			}
+
+			room := open()
+			if tt.before != nil {
+				tt.before(room)
+			}
+			for range 3 {
+				room.forward <- NewMessage("hello", "alice", UserMessageType).ToJSON()
+			}
+			room.do(func() {})
+			if tt.after != nil {
+				tt.after(t, room)
+			}
+			room.stop()
+			<-room.done
+
+			if seq := open().seq; seq != 3 {
+				t.Errorf("seq after restart = %d, want 3", seq)
+			}
+		})
+	}
+}
+
+func TestSeqSaved(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HistoryDir = t.TempDir()
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	room := newRoom("ROOM_ONE", server)
+	go room.run()
+	t.Cleanup(room.stop)
+
+	saved := func() string {
+		t.Helper()
+		data, err := os.ReadFile(room.seqFile())
+		if errors.Is(err, os.ErrNotExist) {
+			return ""
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	post := func() {
+		room.forward <- NewMessage("hello", "alice", UserMessageType).ToJSON()
+		room.do(func() {})
+	}
+
+	post()
+	post()
+	if got := saved(); got != "" {
+		t.Errorf("seq file = %q while running, want it only written on flush or stop", got)
+	}
+	if err := room.flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if got := saved(); got != "2" {
+		t.Errorf("seq file after flush = %q, want 2", got)
+	}
+
+	post()
+	room.stop()
+	<-room.done
+	if got := saved(); got != "3" {
+		t.Errorf("seq file after stop = %q, want 3", got)
+	}
+	if _, err := os.Stat(room.seqFile() + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
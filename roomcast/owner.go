@@ -0,0 +1,162 @@
+package roomcast
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+func init() {
+	registerCommand("kick", kickCommand)
+	registerCommand("ban", banCommand)
+	registerCommand("unban", unbanCommand)
+}
+
+// isOwner reports whether c owns the room, asking the room goroutine.
+// Ownership belongs to the client rather than to its username, so
+// connecting under the owner's name gives no rights.
+func (r *Room) isOwner(c *Client) bool {
+	owner := false
+	r.do(func() { owner = r.owner == c })
+	return owner
+}
+
+// passOwnership gives the room to the member who has been in it the
+// longest, after the owner left. The room has no owner while empty;
+// its next member gets it.
+func (r *Room) passOwnership() {
+	r.owner = nil
+	for client, order := range r.joinOrder {
+		if r.owner == nil || order < r.joinOrder[r.owner] {
+			r.owner = client
+		}
+	}
+	if r.owner != nil {
+		slog.Info("👑 Room owner changed", "user", r.owner.name(), "room", r.name)
+	}
+}
+
+// roomOwnedBy returns a room whose owner is called username but isn't
+// c, or nil. Names are only unique within a room, so /nick checks it to
+// keep members from posing as the owner of another room.
+func (s *Server) roomOwnedBy(username string, c *Client) *Room {
+	s.mu.RLock()
+	rooms := make([]*Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		rooms = append(rooms, room)
+	}
+	s.mu.RUnlock()
+
+	for _, room := range rooms {
+		owned := false
+		room.do(func() { owned = room.owner != nil && room.owner != c && room.owner.name() == username })
+		if owned {
+			return room
+		}
+	}
+	return nil
+}
+
+// requireOwner tells the client off and returns false if it doesn't
+// own room.
+func requireOwner(c *Client, room *Room) bool {
+	if room.isOwner(c) {
+		return true
+	}
+	c.writeError(CodeForbidden, "You are not the room owner.")
+	return false
+}
+
+// kickCommand handles "/kick <user>": the owner of the current room
+// disconnects a member, who is told why while the room is notified.
+func kickCommand(c *Client, args []string) {
+	if len(args) != 1 {
+		c.writeError(CodeUsage, "Usage: /kick <user>")
+		return
+	}
+	room := c.currentRoom()
+	if !requireOwner(c, room) {
+		return
+	}
+
+	username := strings.ToLower(args[0])
+	if username == c.name() {
+		c.writeError(CodeUsage, "You can't kick yourself, use /quit to leave.")
+		return
+	}
+	if !room.kick(username) {
+		c.writeError(CodeNotFound, fmt.Sprintf("No user called %s in %s.", username, room.name))
+		return
+	}
+	slog.Info("👢 Kicked from the room", "user", username, "room", room.name, "by", c.name())
+}
+
+// banCommand handles "/ban <user>": the owner of the current room
+// disconnects a member and refuses new members from the same address
+// for as long as the room is open.
+func banCommand(c *Client, args []string) {
+	if len(args) != 1 {
+		c.writeError(CodeUsage, "Usage: /ban <user>")
+		return
+	}
+	room := c.currentRoom()
+	if !requireOwner(c, room) {
+		return
+	}
+
+	username := strings.ToLower(args[0])
+	if username == c.name() {
+		c.writeError(CodeUsage, "You can't ban yourself.")
+		return
+	}
+	ownIP := remoteIP(c.conn)
+	var ip string
+	room.do(func() {
+		client := room.member(username)
+		if client == nil {
+			return
+		}
+		// Banning the owner's own address would lock it out too
+		if ip = remoteIP(client.conn); ip == ownIP {
+			return
+		}
+		room.bans[ip] = struct{}{}
+		room.expel(client, "banned")
+	})
+	switch ip {
+	case "":
+		c.writeError(CodeNotFound, fmt.Sprintf("No user called %s in %s.", username, room.name))
+	case ownIP:
+		c.writeError(CodeForbidden, fmt.Sprintf("%s connects from your own address, use /kick instead.", username))
+	default:
+		c.writeMessage([]byte(fmt.Sprintf("🚫 %s is banned, /unban %s to let that address in again.\n", username, ip)))
+		slog.Info("🚫 Banned from the room", "user", username, "ip", ip, "room", room.name, "by", c.name())
+	}
+}
+
+// unbanCommand handles "/unban <ip>": the owner of the current room
+// lets the address join again.
+func unbanCommand(c *Client, args []string) {
+	if len(args) != 1 {
+		c.writeError(CodeUsage, "Usage: /unban <ip>")
+		return
+	}
+	room := c.currentRoom()
+	if !requireOwner(c, room) {
+		return
+	}
+
+	ip := args[0]
+	found := false
+	room.do(func() {
+		if _, found = room.bans[ip]; found {
+			delete(room.bans, ip)
+		}
+	})
+	if !found {
+		c.writeError(CodeNotFound, fmt.Sprintf("%s is not banned from %s.", ip, room.name))
+		return
+	}
+	c.writeMessage([]byte(fmt.Sprintf("✅ %s may join %s again.\n", ip, room.name)))
+	slog.Info("✅ Unbanned from the room", "ip", ip, "room", room.name, "by", c.name())
+}
@@ -0,0 +1,276 @@
+package roomcast
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestKick(t *testing.T) {
+	tests := []struct {
+		name string
+		// slow makes bobby stop reading once it has joined.
+		slow bool
+		run  func(t *testing.T, server *Server, alice, bobby, carol *testClient)
+	}{
+		{
+			name: "owner kicks a member",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/kick bobby")
+				bobby.expect("You have been kicked from ROOM_ONE. [" + CodeKicked + "]")
+				bobby.expectClosed()
+				carol.expect("bobby has been kicked from the room")
+				if server.Room("ROOM_ONE").HasClient("bobby") {
+					t.Error("bobby is still a member")
+				}
+			},
+		},
+		{
+			name: "paused member is still told",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				bobby.send("/pause")
+				bobby.expect("Messages are paused")
+				alice.send("/kick bobby")
+				bobby.expect("You have been kicked from ROOM_ONE.")
+				bobby.expectClosed()
+			},
+		},
+		{
+			name: "member that doesn't read",
+			slow: true,
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/kick bobby")
+				carol.expect("bobby has been kicked from the room")
+				alice.send("still serving")
+				carol.expect("💬 still serving")
+				waitFor(t, "bobby to be disconnected", func() bool { return server.Stats().Clients == 2 })
+			},
+		},
+		{
+			name: "not the owner",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				bobby.send("/kick carol")
+				bobby.expect("You are not the room owner.")
+				carol.refute("kicked", 200*time.Millisecond)
+			},
+		},
+		{
+			name: "unknown user",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/kick nobody")
+				alice.expect("No user called nobody in ROOM_ONE.")
+			},
+		},
+		{
+			name: "kicking yourself",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/kick alice")
+				alice.expect("You can't kick yourself")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			alice := join(t, server, "alice", "room_one")
+			var bobby *testClient
+			if tt.slow {
+				bobby = pipe(t, server, func(conn net.Conn) net.Conn { return conn })
+				bobby.setup("bobby", "room_one")
+			} else {
+				bobby = join(t, server, "bobby", "room_one")
+			}
+			carol := join(t, server, "carol", "room_one")
+			alice.expect("carol has joined the room")
+
+			tt.run(t, server, alice, bobby, carol)
+		})
+	}
+}
+
+// addrConn is a connection coming from addr.
+type addrConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c addrConn) RemoteAddr() net.Addr { return c.addr }
+
+// from connects a client to server through net.Pipe, as if it came
+// from ip.
+func from(t *testing.T, server *Server, ip string) *testClient {
+	t.Helper()
+	return pipe(t, server, func(conn net.Conn) net.Conn {
+		return addrConn{Conn: conn, addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000}}
+	})
+}
+
+func TestBan(t *testing.T) {
+	tests := []struct {
+		name string
+		// bobbyIP is the address bobby connects from, alice's own
+		// being 10.0.0.1.
+		bobbyIP string
+		run     func(t *testing.T, server *Server, alice, bobby, carol *testClient)
+	}{
+		{
+			name:    "banned address refused",
+			bobbyIP: "10.0.0.2",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/ban bobby")
+				alice.expect("bobby is banned, /unban 10.0.0.2 to let that address in again.")
+				bobby.expect("You have been banned from ROOM_ONE.")
+				bobby.expectClosed()
+				carol.expect("bobby has been banned from the room")
+
+				again := from(t, server, "10.0.0.2")
+				again.expect("Enter username: ")
+				again.send("bobby")
+				again.expect("Enter room name: ")
+				again.send("room_one")
+				again.expect("Cannot join ROOM_ONE: you are banned from this room.")
+
+				other := from(t, server, "10.0.0.3")
+				other.setup("david", "room_one")
+				carol.expect("david has joined the room")
+			},
+		},
+		{
+			name:    "other rooms stay open",
+			bobbyIP: "10.0.0.2",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/ban bobby")
+				bobby.expectClosed()
+				from(t, server, "10.0.0.2").setup("bobby", "room_two")
+			},
+		},
+		{
+			name:    "unban",
+			bobbyIP: "10.0.0.2",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/ban bobby")
+				alice.expect("bobby is banned")
+				bobby.expectClosed()
+				alice.send("/unban 10.0.0.2")
+				alice.expect("10.0.0.2 may join ROOM_ONE again.")
+				from(t, server, "10.0.0.2").setup("bobby", "room_one")
+				carol.expect("bobby has joined the room")
+			},
+		},
+		{
+			name:    "unban an address that isn't banned",
+			bobbyIP: "10.0.0.2",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/unban 10.0.0.9")
+				alice.expect("10.0.0.9 is not banned from ROOM_ONE.")
+			},
+		},
+		{
+			name:    "owner's own address",
+			bobbyIP: "10.0.0.1",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/ban bobby")
+				alice.expect("bobby connects from your own address, use /kick instead.")
+				carol.refute("banned", 200*time.Millisecond)
+			},
+		},
+		{
+			name:    "not the owner",
+			bobbyIP: "10.0.0.2",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				bobby.send("/ban carol")
+				bobby.expect("You are not the room owner.")
+			},
+		},
+		{
+			name:    "unknown user",
+			bobbyIP: "10.0.0.2",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/ban nobody")
+				alice.expect("No user called nobody in ROOM_ONE.")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			alice := from(t, server, "10.0.0.1")
+			alice.setup("alice", "room_one")
+			bobby := from(t, server, tt.bobbyIP)
+			bobby.setup("bobby", "room_one")
+			carol := from(t, server, "10.0.0.3")
+			carol.setup("carol", "room_one")
+			alice.expect("carol has joined the room")
+
+			tt.run(t, server, alice, bobby, carol)
+		})
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, server *Server, alice, bobby, carol *testClient)
+	}{
+		{
+			name: "owner leaves and someone reconnects under its name",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/quit")
+				alice.expectClosed()
+				bobby.expect("alice has left the room")
+
+				mallory := join(t, server, "alice", "room_one")
+				mallory.send("/kick bobby")
+				mallory.expect("You are not the room owner.")
+
+				// The member who has been in the room the longest owns it.
+				bobby.send("/kick alice")
+				mallory.expect("You have been kicked from ROOM_ONE.")
+			},
+		},
+		{
+			name: "owner leaves an empty room",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				bobby.send("/quit")
+				bobby.expectClosed()
+				alice.send("/quit")
+				alice.expectClosed()
+				waitFor(t, "the room to empty", func() bool { return server.Room("ROOM_ONE").ClientCount() == 0 })
+
+				carol.send("/join room_one")
+				carol.expect("carol 🏠 ROOM_ONE" + ColorReset + " > ")
+				carol.send("/lock s3cret")
+				carol.expect("carol locked the room")
+			},
+		},
+		{
+			name: "renaming to the owner's name",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				carol.send("/nick alice")
+				carol.expect("The name alice is the owner of ROOM_ONE.")
+				carol.send("/nick carla")
+				carol.expect("carol is now known as carla")
+			},
+		},
+		{
+			name: "owner renames",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/nick alicia")
+				alice.expect("alice is now known as alicia")
+				alice.send("/kick bobby")
+				bobby.expect("You have been kicked from ROOM_ONE.")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			alice := join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_one")
+			alice.expect("bobby has joined the room")
+			carol := join(t, server, "carol", "room_two")
+
+			tt.run(t, server, alice, bobby, carol)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package roomcast
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// pasteEnd is the line that ends a /paste block.
+	pasteEnd = "/end"
+
+	// pastePrompt is shown instead of the usual prompt while pasting.
+	pastePrompt = "📋 > "
+
+	// maxPasteLines bounds the number of lines in a single paste.
+	maxPasteLines = 100
+)
+
+func init() {
+	registerCommand("paste", pasteCommand)
+}
+
+// pasteCommand handles "/paste": the following lines, up to a line
+// holding only /end, are sent as a single message.
+func pasteCommand(c *Client, args []string) {
+	c.mu.Lock()
+	c.pasting = true
+	c.mu.Unlock()
+	c.paste = nil
+	c.writeMessage([]byte(fmt.Sprintf("📋 Paste mode: type or paste your text, then %s on its own line.\n", pasteEnd)))
+}
+
+// pasteLine adds a line to the paste in progress, or posts it when the
+// line is pasteEnd. It returns false if the client has been
+// disconnected for flooding.
+func (c *Client) pasteLine(line string) bool {
+	if strings.TrimSpace(line) != pasteEnd {
+		if len(c.paste) >= maxPasteLines {
+			c.writeError(CodeLimitReached, fmt.Sprintf("A paste is limited to %d lines, finish it with %s.", maxPasteLines, pasteEnd))
+			return true
+		}
+		c.paste = append(c.paste, line)
+		return true
+	}
+
+	content := strings.Join(c.paste, "\n")
+	c.mu.Lock()
+	c.pasting = false
+	c.mu.Unlock()
+	c.paste = nil
+
+	if strings.TrimSpace(content) == "" {
+		c.writeMessage([]byte("📋 Empty paste discarded.\n"))
+		return true
+	}
+	return c.post(content, PasteMessageType)
+}
+
+// pastedLines returns the lines that start arriving within
+// Config.PasteWindow of each other after the line just read, taken to
+// be the rest of a paste, at most maxPasteLines in all. Nobody types
+// that fast, so typed lines are left to the read loop.
+//
+// It only applies to text clients: framed and WebSocket clients send
+// whole messages, and a timed out read would break the zlib stream of
+// compressed ones.
+func (c *Client) pastedLines() []string {
+	window := c.server.cfg.PasteWindow
+	if _, text := c.out.(textTransport); window <= 0 || !text || c.caps.framing || isCompressed(c.conn) {
+		return nil
+	}
+
+	var lines []string
+	for len(lines) < maxPasteLines-1 {
+		c.conn.SetReadDeadline(time.Now().Add(window))
+		_, err := c.reader.Peek(1)
+		// The rest of the line may take longer to arrive.
+		c.conn.SetReadDeadline(time.Time{})
+		c.setIdleDeadline()
+		if err != nil {
+			break
+		}
+
+		line, err := readLine(c.reader, false)
+		if err != nil {
+			// Left for the read loop to find on its next read.
+			break
+		}
+		c.seen()
+		lines = append(lines, string(line))
+	}
+
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,69 @@
+package roomcast
+
+import (
+	"fmt"
+)
+
+// maxHeldMessages bounds the messages kept for a paused client.
+const maxHeldMessages = 100
+
+func init() {
+	registerCommand("pause", pauseCommand)
+	registerCommand("resume", resumeCommand)
+}
+
+// hold keeps a formatted message for later if the client is paused
+// and reports whether it did. The oldest messages are dropped once
+// maxHeldMessages are held.
+func (c *Client) hold(msg []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.paused {
+		return false
+	}
+
+	c.held = append(c.held, msg)
+	if len(c.held) > maxHeldMessages {
+		c.heldDropped += len(c.held) - maxHeldMessages
+		c.held = c.held[len(c.held)-maxHeldMessages:]
+	}
+	return true
+}
+
+// pauseCommand handles "/pause": messages are held instead of being
+// shown until /resume.
+func pauseCommand(c *Client, args []string) {
+	c.mu.Lock()
+	c.paused = true
+	c.mu.Unlock()
+
+	c.writeMessage([]byte("⏸️ Messages are paused, type /resume to see them.\n"))
+}
+
+// resumeCommand handles "/resume": it shows the messages held while
+// the client was paused and delivers new ones again.
+func resumeCommand(c *Client, args []string) {
+	c.mu.Lock()
+	wasPaused := c.paused
+	held, dropped := c.held, c.heldDropped
+	c.paused, c.held, c.heldDropped = false, nil, 0
+	c.mu.Unlock()
+
+	if !wasPaused {
+		c.writeError(CodeInvalidState, "Messages are not paused.")
+		return
+	}
+	if len(held) == 0 {
+		c.writeMessage([]byte("▶️ Messages resumed, nothing happened while you were away.\n"))
+		return
+	}
+
+	c.writeMessage([]byte(fmt.Sprintf("▶️ While you were away (%d messages):", len(held))))
+	if dropped > 0 {
+		c.writeMessage([]byte(fmt.Sprintf("\n✂️ %d older messages were dropped.", dropped)))
+	}
+	for _, msg := range held {
+		c.writeMessage(msg)
+	}
+}
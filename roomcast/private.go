@@ -0,0 +1,152 @@
+package roomcast
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerCommand("msg", msgCommand)
+	registerCommand("invite", inviteCommand)
+	registerCommand("whisper", whisperCommand)
+}
+
+// findClients returns the connected clients with the given username,
+// whichever room they are in.
+func (s *Server) findClients(username string) []*Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found []*Client
+	for client := range s.clients {
+		if client.name() == username {
+			found = append(found, client)
+		}
+	}
+	return found
+}
+
+// sendPrivate delivers msg to the connected client named username. As
+// usernames are neither authenticated nor unique across rooms, nothing
+// is kept for users who are offline, and a name several clients share
+// is refused rather than messaging them all. It returns a short status
+// for the sender.
+func (s *Server) sendPrivate(username string, msg Message) string {
+	clients := s.findClients(username)
+	switch {
+	case len(clients) == 0:
+		return "offline"
+	case len(clients) > 1:
+		return "ambiguous"
+	case !clients[0].deliver(msg):
+		return "too slow"
+	}
+	return "delivered"
+}
+
+// msgCommand handles "/msg <user> <text>": it sends a private message
+// to a connected user in any room.
+func msgCommand(c *Client, args []string) {
+	if len(args) < 2 {
+		c.writeError(CodeUsage, "Usage: /msg <user> <text>")
+		return
+	}
+
+	target := strings.ToLower(args[0])
+	msg := NewMessage(strings.Join(args[1:], " "), c.name(), PrivateMessageType)
+
+	switch status := c.server.sendPrivate(target, msg); status {
+	case "delivered":
+		c.writeMessage([]byte(fmt.Sprintf("✅ Message delivered to %s.\n", target)))
+	case "offline":
+		c.writeError(CodeNotFound, fmt.Sprintf("%s is not connected, private messages are not kept for offline users.", target))
+	case "ambiguous":
+		c.writeError(CodeUndeliverable, fmt.Sprintf("Several users are called %s, use /whisper in their room.", target))
+	default:
+		c.writeError(CodeUndeliverable, fmt.Sprintf("Could not deliver to %s: %s.", target, status))
+	}
+}
+
+// inviteCommand handles "/invite <user> [room]": it tells a connected
+// user, whichever room they are in, that they are invited to a room,
+// the current one by default. The invitee stays where they are.
+func inviteCommand(c *Client, args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		c.writeError(CodeUsage, "Usage: /invite <user> [room]")
+		return
+	}
+
+	target := strings.ToLower(args[0])
+	room := c.currentRoom().name
+	if len(args) == 2 {
+		if !c.server.isValidRoomName(args[1]) {
+			c.writeError(CodeInvalidName, "Invalid room name.")
+			return
+		}
+		room = strings.ToUpper(args[1])
+	}
+
+	invitees := c.server.findClients(target)
+	if len(invitees) == 0 {
+		c.writeError(CodeNotFound, fmt.Sprintf("%s is not connected.", target))
+		return
+	}
+
+	notice := NewMessage(fmt.Sprintf("✉️ %s invited you to %s, type /join %s to go there.\n", c.name(), room, room), c.name(), NotificationType)
+	delivered, already := false, false
+	for _, invitee := range invitees {
+		if invitee.joinedRoom(room) != nil {
+			already = true
+			continue
+		}
+		if invitee.deliver(notice) {
+			delivered = true
+		}
+	}
+
+	switch {
+	case delivered:
+		c.writeMessage([]byte(fmt.Sprintf("✅ Invitation to %s delivered to %s.\n", room, target)))
+	case already:
+		c.writeMessage([]byte(fmt.Sprintf("🏠 %s is already in %s.\n", target, room)))
+	default:
+		c.writeError(CodeUndeliverable, fmt.Sprintf("Could not deliver the invitation to %s.", target))
+	}
+}
+
+// whisperCommand handles "/whisper <user> <text>": it sends a message
+// to a member of the current room only. Whispers never reach the
+// room's history.
+func whisperCommand(c *Client, args []string) {
+	if len(args) < 2 {
+		c.writeError(CodeUsage, "Usage: /whisper <user> <text>")
+		return
+	}
+
+	target := strings.ToLower(args[0])
+	msg := NewMessage(strings.Join(args[1:], " "), c.name(), WhisperMessageType)
+	room := c.currentRoom()
+	msg.Room = room.name
+
+	found, delivered := false, false
+	room.do(func() {
+		for member := range room.clients {
+			if member.name() != target {
+				continue
+			}
+			found = true
+			if member.deliver(msg) {
+				delivered = true
+			}
+		}
+	})
+
+	switch {
+	case !found:
+		c.writeError(CodeNotFound, fmt.Sprintf("User %s not found in %s.", target, room.name))
+	case !delivered:
+		c.writeError(CodeUndeliverable, fmt.Sprintf("Could not deliver to %s.", target))
+	default:
+		c.writeMessage([]byte(fmt.Sprintf("🔒 Whispered to %s.\n", target)))
+	}
+}
@@ -0,0 +1,63 @@
+package roomcast
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMsg(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, server *Server, alice, bobby *testClient)
+	}{
+		{
+			name: "connected user in another room",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				alice.send("/msg bobby psst")
+				alice.expect("Message delivered to bobby.")
+				bobby.expect("(private from alice): psst")
+			},
+		},
+		{
+			name: "offline user",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				bobby.send("/quit")
+				bobby.expectClosed()
+				waitFor(t, "bobby to leave", func() bool { return server.Stats().Clients == 1 })
+
+				alice.send("/msg bobby are you there")
+				alice.expect("bobby is not connected, private messages are not kept for offline users.")
+
+				// Whoever connects as bobby next gets nothing.
+				mallory := join(t, server, "bobby", "room_two")
+				mallory.refute("are you there", 200*time.Millisecond)
+			},
+		},
+		{
+			name: "name used in several rooms",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				other := join(t, server, "bobby", "room_one")
+				alice.send("/msg bobby psst")
+				alice.expect("Several users are called bobby, use /whisper in their room.")
+				bobby.refute("psst", 200*time.Millisecond)
+				other.refute("psst", 200*time.Millisecond)
+			},
+		},
+		{
+			name: "unknown user",
+			run: func(t *testing.T, server *Server, alice, bobby *testClient) {
+				alice.send("/msg nobody hello")
+				alice.expect("nobody is not connected")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			alice := join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_two")
+
+			tt.run(t, server, alice, bobby)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package roomcast
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxProxyHeader is the longest PROXY protocol v1 header allowed by the spec.
+const maxProxyHeader = 107
+
+// proxyHeaderTimeout bounds the wait for the PROXY header.
+const proxyHeaderTimeout = 5 * time.Second
+
+var errBadProxyHeader = errors.New("malformed PROXY protocol header")
+
+// proxiedConn is a connection whose remote address is the client's, as
+// announced by the load balancer in the PROXY header.
+type proxiedConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *proxiedConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// readProxyHeader reads the PROXY protocol v1 header the load balancer
+// sends first, e.g. "PROXY TCP4 203.0.113.7 10.0.0.1 51234 11111", and
+// returns conn with the client's address as its remote address. Only
+// enable it behind a trusted load balancer: anyone reaching the server
+// directly could otherwise claim any address.
+func readProxyHeader(conn net.Conn, reader *bufio.Reader) (net.Conn, error) {
+	conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	line, err := reader.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, errBadProxyHeader
+		}
+		return nil, err
+	}
+	if len(line) > maxProxyHeader || !strings.HasSuffix(string(line), "\r\n") {
+		return nil, errBadProxyHeader
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, errBadProxyHeader
+	}
+	if fields[1] == "UNKNOWN" {
+		// The balancer doesn't know the client, e.g. for health checks.
+		return conn, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errBadProxyHeader
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil || (ip.To4() != nil) != (fields[1] == "TCP4") {
+		return nil, fmt.Errorf("%w: bad source address %q", errBadProxyHeader, fields[2])
+	}
+	port, err := strconv.Atoi(fields[4])
+	if err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("%w: bad source port %q", errBadProxyHeader, fields[4])
+	}
+
+	return &proxiedConn{Conn: conn, remote: &net.TCPAddr{IP: ip, Port: port}}, nil
+}
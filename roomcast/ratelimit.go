@@ -0,0 +1,186 @@
+package roomcast
+
+import (
+	"time"
+)
+
+// rateVerdict is the outcome of checking a message against a rateLimiter.
+type rateVerdict int
+
+const (
+	// rateAllowed means the message can be forwarded.
+	rateAllowed rateVerdict = iota
+	// rateWarned means the message is dropped and the client warned.
+	rateWarned
+	// rateCooldown means the message is dropped and a cooldown starts,
+	// during which the client can't send anything.
+	rateCooldown
+	// rateMuted means the message is dropped silently, since the client
+	// was told when its cooldown started.
+	rateMuted
+	// rateKicked means the client kept flooding and must be disconnected.
+	rateKicked
+)
+
+// rateLimiter is a per-client token bucket. Clients that keep
+// exceeding it within a window get a warning first, then a send
+// cooldown that doubles with each violation, and finally a kick.
+// It is only used from the client's read goroutine.
+type rateLimiter struct {
+	cfg Config
+
+	tokens float64
+	last   time.Time
+
+	violations    int
+	lastViolation time.Time
+	cooldownUntil time.Time
+}
+
+func newRateLimiter(cfg Config) *rateLimiter {
+	return &rateLimiter{
+		cfg:    cfg,
+		tokens: float64(cfg.RateBurst),
+	}
+}
+
+// check accounts for one message sent at now.
+func (l *rateLimiter) check(now time.Time) rateVerdict {
+	if l.cfg.RateLimit <= 0 {
+		return rateAllowed
+	}
+
+	if now.Before(l.cooldownUntil) {
+		return rateMuted
+	}
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.cfg.RateLimit
+		if l.tokens > float64(l.cfg.RateBurst) {
+			l.tokens = float64(l.cfg.RateBurst)
+		}
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return rateAllowed
+	}
+
+	if now.Sub(l.lastViolation) > l.cfg.ViolationWindow {
+		l.violations = 0
+	}
+	l.violations++
+	l.lastViolation = now
+
+	switch {
+	case l.cfg.KickAfterViolations > 0 && l.violations >= l.cfg.KickAfterViolations:
+		return rateKicked
+	case l.violations == 1:
+		return rateWarned
+	}
+
+	cooldown := l.cfg.CooldownBase << (l.violations - 2)
+	if cooldown > l.cfg.CooldownMax || cooldown <= 0 {
+		cooldown = l.cfg.CooldownMax
+	}
+	l.cooldownUntil = now.Add(cooldown)
+	return rateCooldown
+}
+
+// cooldownLeft returns how long the client still has to wait.
+func (l *rateLimiter) cooldownLeft(now time.Time) time.Duration {
+	return l.cooldownUntil.Sub(now).Round(time.Second)
+}
+
+// admissionLimiter is a per-room token bucket bounding how fast new
+// members are admitted, so that a join flood can't swamp the room.
+// It is only used from the room goroutine.
+type admissionLimiter struct {
+	rate  float64
+	burst int
+
+	tokens float64
+	last   time.Time
+}
+
+func newAdmissionLimiter(cfg Config) *admissionLimiter {
+	return &admissionLimiter{
+		rate:   cfg.JoinRate,
+		burst:  cfg.JoinBurst,
+		tokens: float64(cfg.JoinBurst),
+	}
+}
+
+// admit reports whether a member can join at now.
+func (l *admissionLimiter) admit(now time.Time) bool {
+	if l.rate <= 0 {
+		return true
+	}
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// byteSample is the size of a message sent at a given time.
+type byteSample struct {
+	at   time.Time
+	size int
+}
+
+// byteLimiter bounds the bytes a client sends over a sliding window,
+// independently of the number of messages. It is only used from the
+// client's read goroutine.
+type byteLimiter struct {
+	rate   int
+	window time.Duration
+
+	samples []byteSample
+	total   int
+}
+
+func newByteLimiter(cfg Config) *byteLimiter {
+	return &byteLimiter{
+		rate:   cfg.ByteRate,
+		window: cfg.ByteRateWindow,
+	}
+}
+
+// budget returns the number of bytes allowed within the window.
+func (l *byteLimiter) budget() int {
+	return int(float64(l.rate) * l.window.Seconds())
+}
+
+// fits reports whether n more bytes can be sent at now.
+func (l *byteLimiter) fits(now time.Time, n int) bool {
+	if l.rate <= 0 {
+		return true
+	}
+
+	cutoff := now.Add(-l.window)
+	for len(l.samples) > 0 && !l.samples[0].at.After(cutoff) {
+		l.total -= l.samples[0].size
+		l.samples = l.samples[1:]
+	}
+	return l.total+n <= l.budget()
+}
+
+// record accounts for n bytes sent at now.
+func (l *byteLimiter) record(now time.Time, n int) {
+	if l.rate <= 0 {
+		return
+	}
+	l.samples = append(l.samples, byteSample{at: now, size: n})
+	l.total += n
+}
@@ -0,0 +1,71 @@
+package roomcast
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    float64
+		burst   int
+		kick    int
+		sent    int
+		reached int
+		notices []string
+		kicked  bool
+	}{
+		{name: "disabled", rate: 0, sent: 10, reached: 10},
+		{
+			name:    "burst",
+			rate:    0.5,
+			burst:   3,
+			sent:    10,
+			reached: 3,
+			notices: []string{"You are sending messages too fast", "You are muted for flooding"},
+		},
+		{
+			name:    "kicked",
+			rate:    0.5,
+			burst:   3,
+			kick:    2,
+			sent:    10,
+			reached: 3,
+			notices: []string{"You are sending messages too fast", "You have been disconnected for flooding."},
+			kicked:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.RateLimit = tt.rate
+			if tt.burst > 0 {
+				cfg.RateBurst = tt.burst
+			}
+			cfg.KickAfterViolations = tt.kick
+			server := startServer(t, cfg)
+			alice := join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_one")
+			alice.expect("bobby has joined the room")
+
+			for i := range tt.sent {
+				// Fails once alice is kicked.
+				alice.conn.Write(fmt.Appendf(nil, "message %d\n", i))
+			}
+
+			bobby.expect(fmt.Sprintf("💬 message %d", tt.reached-1))
+			bobby.refute("💬 message", 300*time.Millisecond)
+			for _, notice := range tt.notices {
+				alice.expect(notice)
+			}
+			if tt.kicked {
+				alice.expectClosed()
+				return
+			}
+			// Each notice is only sent once.
+			alice.refute("❌", 300*time.Millisecond)
+		})
+	}
+}
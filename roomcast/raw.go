@@ -0,0 +1,27 @@
+package roomcast
+
+func init() {
+	registerCommand("raw", rawCommand)
+}
+
+// received records the JSON of a message delivered to the client, for /raw.
+func (c *Client) received(rawMessage []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastReceived = rawMessage
+}
+
+// rawCommand handles "/raw": it shows the client the JSON of the last
+// message it received, exactly as sent on the wire, so client
+// developers can check their parser against it.
+func rawCommand(c *Client, args []string) {
+	c.mu.Lock()
+	raw := c.lastReceived
+	c.mu.Unlock()
+
+	if raw == nil {
+		c.writeMessage([]byte("📭 No message received yet.\n"))
+		return
+	}
+	c.writeMessage(append([]byte("🧾 "), append(raw, '\n')...))
+}
@@ -0,0 +1,62 @@
+package roomcast
+
+import (
+	"net"
+	"time"
+)
+
+// rejoinCommand is typed at the room name prompt to go back to the
+// last room used from the same address with the same username.
+const rejoinCommand = "/rejoin"
+
+// lastRoom is the room an identity was last in.
+type lastRoom struct {
+	room string
+	at   time.Time
+}
+
+// remoteIP returns the IP address of the peer of conn.
+func remoteIP(conn net.Conn) string {
+	return addrIP(conn.RemoteAddr().String())
+}
+
+// addrIP returns the IP address of a host:port address.
+func addrIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// rememberRoom records the room a user joined from an address, and
+// forgets records older than Config.RejoinTTL.
+func (s *Server) rememberRoom(ip, username, room string) {
+	if s.cfg.RejoinTTL <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, last := range s.lastRooms {
+		if now.Sub(last.at) > s.cfg.RejoinTTL {
+			delete(s.lastRooms, key)
+		}
+	}
+	s.lastRooms[ip+"/"+username] = lastRoom{room: room, at: now}
+}
+
+// lastRoomOf returns the room a user last joined from an address, if
+// it is recent enough.
+func (s *Server) lastRoomOf(ip, username string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	last, ok := s.lastRooms[ip+"/"+username]
+	if !ok || time.Since(last.at) > s.cfg.RejoinTTL {
+		return "", false
+	}
+	return last.room, true
+}
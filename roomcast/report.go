@@ -0,0 +1,94 @@
+package roomcast
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Report is a message flagged by a user for moderator review.
+type Report struct {
+	Room      string
+	MessageID string
+	// Sender and Content are empty when the message had already
+	// dropped out of the room's recent messages.
+	Sender   string
+	Content  string
+	Reporter string
+	Reason   string
+	Time     time.Time
+}
+
+func init() {
+	registerCommand("report", reportCommand)
+	registerAdminCommand("reports", reportsCommand)
+}
+
+// addReport stores a report so admins can review it later.
+func (s *Server) addReport(report Report) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports = append(s.reports, report)
+}
+
+// listReports returns a copy of the stored reports, oldest first.
+func (s *Server) listReports() []Report {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Report(nil), s.reports...)
+}
+
+// reportCommand handles "/report <messageId> <reason>": it flags a
+// message of the current room and notifies the online admins.
+// The reported user is not told about it.
+func reportCommand(c *Client, args []string) {
+	if len(args) < 2 {
+		c.writeError(CodeUsage, "Usage: /report <messageId> <reason>")
+		return
+	}
+
+	room := c.currentRoom()
+	id := strings.TrimPrefix(args[0], "#")
+	report := Report{
+		Room:      room.name,
+		MessageID: id,
+		Reporter:  c.name(),
+		Reason:    strings.Join(args[1:], " "),
+		Time:      time.Now(),
+	}
+	if msg, ok := room.findMessage(id); ok {
+		report.MessageID = msg.ID
+		report.Sender = msg.Sender
+		report.Content = msg.Content
+	}
+
+	c.server.addReport(report)
+	slog.Info("🚩 Message reported", "user", report.Reporter, "room", room.name, "id", id, "reason", report.Reason)
+
+	notice := NewMessage(fmt.Sprintf("🚩 %s reported message #%s in %s: %s\n", report.Reporter, id, room.name, report.Reason), "", NotificationType)
+	for _, admin := range c.server.admins() {
+		admin.deliver(notice)
+	}
+
+	c.writeMessage([]byte(fmt.Sprintf("✅ Message #%s has been reported to the moderators.\n", id)))
+}
+
+// reportsCommand handles "/reports" (admin): it lists every stored report.
+func reportsCommand(c *Client, args []string) {
+	reports := c.server.listReports()
+	if len(reports) == 0 {
+		c.writeMessage([]byte("📭 No reports.\n"))
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "🚩 %d reports:\n", len(reports))
+	for _, r := range reports {
+		fmt.Fprintf(&b, "[%s] %s #%s by %s: %s\n", r.Time.Format("2006-01-02 15:04:05"), r.Room, shortID(r.MessageID), r.Reporter, r.Reason)
+		if r.Sender != "" {
+			fmt.Fprintf(&b, "    %s 💬 %s\n", r.Sender, r.Content)
+		}
+	}
+	c.writeMessage([]byte(b.String()))
+}
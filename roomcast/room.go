@@ -0,0 +1,706 @@
+package roomcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMaxClients is the default capacity of a room.
+const defaultMaxClients = 10
+const maxHistory = 100
+
+// maxHistoryLine bounds the length of a line read from a history file.
+const maxHistoryLine = 1 << 20
+
+// Room represents a chat room where clients can communicate.
+// The room name is displayed in a unique color in the terminal for visual distinction.
+type Room struct {
+	// forward is a channel that holds incoming messages
+	// that should be forwarded to the other clients.
+	forward chan []byte
+
+	// join is a channel for clients wishing to join the room.
+	join chan *Client
+
+	// leave is a channel for clients wishing to leave the room.
+	leave chan *Client
+
+	// ctx is canceled to shut the room down, when it is stopped or the
+	// server shuts down, and done is closed once run has returned.
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// requests carries functions to run inside the room goroutine,
+	// giving them safe access to the clients map.
+	requests chan func()
+
+	// clients holds all current clients in this room.
+	clients map[*Client]struct{}
+
+	// name is the identifier of the room, displayed in the terminal
+	// with a unique color for visual distinction.
+	name string
+
+	// color is the ANSI color code used to display the room name
+	// in the terminal. Each room has a unique color for better
+	// visual organization.
+	color string
+
+	historyFile string
+
+	// server is the server the room belongs to.
+	server *Server
+
+	// lastID is the number of the last forwarded message, and
+	// reservedID the highest number reserved on disk.
+	lastID     int
+	reservedID int
+
+	// seq is the sequence number of the last forwarded message. Unlike
+	// IDs, sequence numbers have no gaps. After a restart they continue
+	// from the number saved in the seq file, see saveSeq. It is owned by
+	// the room goroutine once the room runs.
+	seq uint64
+
+	// recent holds the last historySize messages saved to the history,
+	// oldest first. It is what members are sent when they join, while
+	// the history file is the durable log.
+	recent []Message
+
+	// admission bounds how fast new members join.
+	admission *admissionLimiter
+
+	// capacity is the most members the room holds at once.
+	capacity int
+
+	// memberCount mirrors len(clients) and forwarded counts the
+	// forwarded messages, so stats can be read without waiting for
+	// the room goroutine.
+	memberCount atomic.Int64
+	forwarded   atomic.Int64
+
+	// frozen is set while an admin has frozen the room with /freeze:
+	// only admins can post in it. Clients read it when posting.
+	frozen atomic.Bool
+
+	// throughput holds the size of the messages forwarded within the
+	// throughput window, oldest first. It is owned by the room goroutine.
+	throughput []byteSample
+
+	// topic describes what the room is about. It is owned by the room
+	// goroutine.
+	topic string
+
+	// motd is the message of the day set by an admin, overriding the
+	// server's one when not empty.
+	motd string
+
+	// historyLines is the number of lines in the history file.
+	historyLines int
+
+	// saves queues the messages to save for the history writer when
+	// Config.HistoryQueue is set, nil otherwise. saved is closed once
+	// the writer has saved the last of them. clears asks the writer to
+	// clear the history, see clearHistory.
+	saves  chan Message
+	saved  chan struct{}
+	clears chan chan error
+
+	// persist makes the room save its messages to the history file.
+	// Admins can turn it off with /logging for unlogged sessions.
+	persist bool
+
+	// lock holds the password hash of a locked room, nil otherwise.
+	lock *roomLock
+
+	// createdBy is the username of the client whose join created the
+	// room. It never changes, so it can be read without locking.
+	createdBy string
+
+	// owner is the member who may lock the room and kick members: its
+	// first member, then, whenever the owner leaves, the member who has
+	// been in the room the longest. joinOrder numbers the members in the
+	// order they joined, joins being the last number given, and bans
+	// holds the addresses the owner banned. All are owned by the room
+	// goroutine.
+	owner     *Client
+	joinOrder map[*Client]uint64
+	joins     uint64
+	bans      map[string]struct{}
+
+	// renames holds the names members are taking with /nick, kept from
+	// other members until the rename is done in every room of the
+	// renamer. It is owned by the room goroutine.
+	renames map[string]*Client
+
+	// historyMu guards the history file and historyLines. It is taken
+	// before mu when both are needed, and kept apart from it so that
+	// the room goroutine doesn't wait for the history writer's disk
+	// writes to read persist or the recent messages.
+	historyMu sync.Mutex
+
+	// mu guards recent, motd, persist and lock.
+	mu sync.Mutex
+}
+
+// newRoom creates a new chat room instance with the given name.
+// The room is initialized with all necessary channels; its color is
+// picked by the server so that it differs from the other rooms.
+// Returns a pointer to the newly created Room instance.
+func newRoom(name string, server *Server) *Room {
+	ctx, cancel := context.WithCancel(server.ctx)
+	room := &Room{
+		name:        name,
+		forward:     make(chan []byte),
+		join:        make(chan *Client),
+		leave:       make(chan *Client),
+		clients:     make(map[*Client]struct{}),
+		joinOrder:   make(map[*Client]uint64),
+		bans:        make(map[string]struct{}),
+		renames:     make(map[string]*Client),
+		ctx:         ctx,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		requests:    make(chan func()),
+		historyFile: historyPath(server.cfg.HistoryDir, name),
+		server:      server,
+		admission:   newAdmissionLimiter(server.cfg),
+		capacity:    server.cfg.MaxClients,
+		persist:     true,
+	}
+	if size := server.cfg.HistoryQueue; size > 0 {
+		room.saves = make(chan Message, size)
+		room.saved = make(chan struct{})
+		room.clears = make(chan chan error)
+	}
+	room.loadIDs()
+	room.loadHistory()
+	room.loadSeq()
+	room.loadTopic()
+
+	return room
+}
+
+// run manages the core chat room operations including:
+// - Handling client joins and leaves.
+// - Forwarding messages to all connected clients
+// - Managing room capacity
+// - Handling shutdown signals
+// This method runs in an infinite loop until the room is stopped.
+func (r *Room) run() {
+	defer close(r.done)
+	slog.Debug("🔄 Starting room", "room", r.name)
+	if r.saves != nil {
+		go r.historyWriter()
+	}
+
+	// Stuck members are looked for twice per DrainTimeout, so none
+	// lingers for more than 1.5 times the timeout.
+	var drainCheck <-chan time.Time
+	if timeout := r.server.cfg.DrainTimeout; timeout > 0 {
+		ticker := time.NewTicker(timeout / 2)
+		defer ticker.Stop()
+		drainCheck = ticker.C
+	}
+
+	for {
+		select {
+		// joining
+		case client := <-r.join:
+			// Joining twice is a no-op, so members never count twice
+			// against the capacity or get announced twice.
+			if _, exists := r.clients[client]; exists {
+				client.joined <- nil
+				continue
+			}
+			// Checked here rather than during setup so that two
+			// clients racing for the same name can't both get in.
+			if _, banned := r.bans[remoteIP(client.conn)]; banned {
+				slog.Info("🚫 Banned address refused", "user", client.name(), "room", r.name)
+				client.joined <- errBanned
+				continue
+			}
+			if r.hasMember(client.name()) || r.renames[client.name()] != nil {
+				slog.Info("❌ Username already taken", "user", client.name(), "room", r.name)
+				client.joined <- errNameTaken
+				continue
+			}
+			if len(r.clients) >= r.capacity {
+				slog.Info("❌ Room is full", "room", r.name, "user", client.name())
+				client.joined <- errRoomFull
+				continue
+			}
+			if !r.admission.admit(time.Now()) {
+				slog.Info("🚦 Room is admitting members slowly", "room", r.name, "user", client.name())
+				client.joined <- errJoinThrottled
+				continue
+			}
+			r.clients[client] = struct{}{}
+			r.memberCount.Store(int64(len(r.clients)))
+			r.joins++
+			r.joinOrder[client] = r.joins
+			if r.owner == nil {
+				r.owner = client
+			}
+			slog.Info("✅ Joined room", "user", client.name(), "room", r.name)
+			client.joined <- nil
+
+			// Notify others
+			r.broadcast(&Message{
+				Content: fmt.Sprintf("📢 %s has joined the room.\n", client.name()),
+				Sender:  client.name(),
+				Type:    NotificationType,
+				Room:    r.name,
+			}, client)
+
+		// leaving
+		case client := <-r.leave:
+			if !r.removeClient(client) {
+				continue
+			}
+
+			// Notify others
+			r.broadcast(&Message{
+				Content: fmt.Sprintf("📢 %s has left the room.\n", client.name()),
+				Sender:  client.name(),
+				Type:    NotificationType,
+				Room:    r.name,
+			}, client)
+
+		// forward message to all clients
+		case msgBytes := <-r.forward:
+			msg, err := FromJSON(msgBytes)
+			if err != nil {
+				slog.Error("❌ Failed to parse message JSON", "room", r.name, "err", err)
+				continue
+			}
+			msg.ID = r.nextID()
+			msg.Seq = r.nextSeq()
+			msgBytes = msg.ToJSON()
+			r.forwarded.Add(1)
+			r.recordForward(time.Now(), len(msgBytes))
+			r.server.forwarded.Add(1)
+			r.server.metrics.forwarded.Inc()
+
+			r.save(msg)
+			r.remember(msg)
+			r.server.federate(msg)
+			if !msg.Expires.IsZero() {
+				r.scheduleExpiry(msg)
+			}
+
+			r.broadcast(&msg, nil)
+
+		case fn := <-r.requests:
+			fn()
+
+		case <-drainCheck:
+			r.dropStuckClients()
+
+		case <-r.ctx.Done():
+			slog.Debug("🛑 Shutting down room", "room", r.name)
+			for client := range r.clients {
+				// Closing the connection ends the client's read loop,
+				// which releases the client once it has left its rooms.
+				client.conn.Close()
+				delete(r.clients, client)
+			}
+			r.memberCount.Store(0)
+			r.saveSeq()
+			if r.saves != nil {
+				// Let the history writer save what is still queued.
+				close(r.saves)
+				<-r.saved
+			}
+			r.closeHistory()
+			slog.Debug("✅ Room shutdown complete", "room", r.name)
+			r.server.tryEmit(Event{Type: EventRoomClosed, Room: r.name})
+			return
+		}
+	}
+}
+
+// stop gracefully shuts down the room by canceling its context: run
+// then disconnects the members and returns.
+func (r *Room) stop() {
+	r.cancel()
+}
+
+// do runs fn in the room goroutine and waits for it to finish.
+// It returns false if the room has been stopped.
+func (r *Room) do(fn func()) bool {
+	done := make(chan struct{})
+	select {
+	case r.requests <- func() { fn(); close(done) }:
+	case <-r.ctx.Done():
+		return false
+	}
+	<-done
+	return true
+}
+
+// members returns the room members sorted by username.
+func (r *Room) members() []*Client {
+	var members []*Client
+	r.do(func() {
+		for client := range r.clients {
+			members = append(members, client)
+		}
+	})
+	sort.Slice(members, func(i, j int) bool { return members[i].name() < members[j].name() })
+	return members
+}
+
+// memberNames returns the sorted usernames of the room members.
+func (r *Room) memberNames() []string {
+	var names []string
+	for _, client := range r.members() {
+		names = append(names, client.name())
+	}
+	return names
+}
+
+// kick disconnects the member with the given username and reports
+// whether it was found.
+func (r *Room) kick(username string) bool {
+	found := false
+	r.do(func() {
+		if client := r.member(username); client != nil {
+			found = true
+			r.expel(client, "kicked")
+		}
+	})
+	return found
+}
+
+// expelGrace is how long an expelled client's writer has to deliver
+// the notice before its connection is closed anyway.
+const expelGrace = 2 * time.Second
+
+// expel disconnects a member, telling it and the rest of the room that
+// it has been kicked or banned, as given by verb. It must only be
+// called from the room goroutine, so it never writes to the client: the
+// notice goes to the client's urgent queue, and its writer closes the
+// connection once the notice is written. The connection is closed
+// without waiting for the writer if the queue is full, or after
+// expelGrace if the writer is stuck.
+func (r *Room) expel(client *Client, verb string) {
+	r.removeClient(client)
+	notice := newError(CodeKicked, fmt.Sprintf("You have been %s from %s.", verb, r.name))
+	notice.Room = r.name
+	select {
+	case client.urgent <- notice.ToJSON():
+		time.AfterFunc(expelGrace, func() { client.conn.Close() })
+	default:
+		go client.conn.Close()
+	}
+	r.broadcast(&Message{
+		Content: fmt.Sprintf("📢 %s has been %s from the room.\n", client.name(), verb),
+		Type:    NotificationType,
+		Room:    r.name,
+	}, nil)
+}
+
+// ClientCount returns the number of members of the room. It is
+// answered by the room goroutine, so it never races with joins and
+// leaves. It returns 0 once the room is stopped.
+func (r *Room) ClientCount() int {
+	count := 0
+	r.do(func() { count = len(r.clients) })
+	return count
+}
+
+// HasClient reports whether a member of the room is called username,
+// asking the room goroutine like ClientCount.
+func (r *Room) HasClient(username string) bool {
+	found := false
+	r.do(func() { found = r.hasMember(username) })
+	return found
+}
+
+// hasMember reports whether a member of the room is called username.
+// It must only be called from the room goroutine.
+func (r *Room) hasMember(username string) bool {
+	return r.member(username) != nil
+}
+
+// member returns the member called username, or nil. It must only be
+// called from the room goroutine.
+func (r *Room) member(username string) *Client {
+	for client := range r.clients {
+		if client.name() == username {
+			return client
+		}
+	}
+	return nil
+}
+
+// removeClient removes the client from the room and reports whether
+// it was a member. The client's connection is left open since it may
+// still be chatting in other rooms.
+func (r *Room) removeClient(client *Client) bool {
+	if _, exists := r.clients[client]; !exists {
+		return false
+	}
+
+	delete(r.clients, client)
+	delete(r.joinOrder, client)
+	r.memberCount.Store(int64(len(r.clients)))
+	slog.Info("✅ Left room", "user", client.name(), "room", r.name)
+	if r.owner == client {
+		r.passOwnership()
+	}
+	r.server.tryEmit(Event{Type: EventClientLeft, Room: r.name, Username: client.name()})
+	return true
+}
+
+// broadcast sends msg to every member but exclude, which may be nil.
+// The sender is excluded by identity rather than by username so that
+// members sharing a name still get each other's notifications.
+func (r *Room) broadcast(msg *Message, exclude *Client) {
+	jsonMessage := msg.ToJSON()
+	var slow []*Client
+	for client := range r.clients {
+		if client != exclude && !r.safeSend(client, msg, jsonMessage) {
+			slow = append(slow, client)
+		}
+	}
+	r.dropClients(slow)
+}
+
+// safeSend queues data, the encoded msg, for client without blocking
+// the room. It reports false if the client's queue is full; a client
+// already disconnected isn't slow, its leave is on the way.
+func (r *Room) safeSend(client *Client, msg *Message, data []byte) bool {
+	if queued, closed := client.enqueue(client.queueFor(msg), data); queued || closed {
+		return true
+	}
+	slog.Warn("❌ Failed to send message, client too slow", "user", client.name(), "room", r.name)
+	r.server.metrics.dropped.Inc()
+	return false
+}
+
+// dropClients disconnects clients that can't keep up and tells the
+// rest of the room they left; their read loop then notifies the other
+// rooms they were in. Clients already dropped while telling the room
+// about an earlier one are skipped.
+func (r *Room) dropClients(clients []*Client) {
+	for _, client := range clients {
+		if !r.removeClient(client) {
+			continue
+		}
+		client.conn.Close()
+		r.broadcast(&Message{
+			Content: fmt.Sprintf("📢 %s has left the room.\n", client.name()),
+			Sender:  client.name(),
+			Type:    NotificationType,
+			Room:    r.name,
+		}, client)
+	}
+}
+
+// historySize returns the number of recent messages kept in memory:
+// Config.HistoryLimit, or maxHistory when the history file is unbounded.
+func (r *Room) historySize() int {
+	if limit := r.server.cfg.HistoryLimit; limit > 0 {
+		return limit
+	}
+	return maxHistory
+}
+
+// remember keeps msg among the recent messages, dropping the oldest
+// once historySize is reached. Messages sent while logging is disabled
+// are not kept.
+func (r *Room) remember(msg Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.persist {
+		return
+	}
+	r.recent = append(r.recent, msg)
+	if size := r.historySize(); len(r.recent) > size {
+		r.recent = slices.Delete(r.recent, 0, len(r.recent)-size)
+	}
+}
+
+// recentMessages returns a copy of the last n recent messages, oldest
+// first, or all of them when n is zero or negative.
+func (r *Room) recentMessages(n int) []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recent := r.recent
+	if n > 0 && len(recent) > n {
+		recent = recent[len(recent)-n:]
+	}
+	return slices.Clone(recent)
+}
+
+// isLogged reports whether the room saves its messages to its history.
+func (r *Room) isLogged() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.persist
+}
+
+// findMessage looks up a recent message by ID, either in full or
+// as shown to users.
+func (r *Room) findMessage(id string) (Message, bool) {
+	if !strings.Contains(id, ":") {
+		id = r.name + ":" + id
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, msg := range r.recent {
+		if msg.ID == id {
+			return msg, true
+		}
+	}
+	return Message{}, false
+}
+
+// historyFileName returns the name of the history file of a room.
+// Names made only of A-Z, 0-9 and _ are used as is; others are
+// hex-encoded behind a "~", which can't appear in a plain name, so
+// every room maps to its own file whatever the characters in its name
+// or the case sensitivity of the file system.
+func historyFileName(room string) string {
+	for _, r := range room {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' {
+			return fmt.Sprintf("history_~%x", room)
+		}
+	}
+	return "history_" + room
+}
+
+// historyPath returns the path of the history file of a room in dir.
+// historyFileName never produces separators, and sanitizeFilename makes
+// sure no future change to it lets a room name escape dir.
+func historyPath(dir, room string) string {
+	name, err := sanitizeFilename(historyFileName(room))
+	if err != nil {
+		name = fmt.Sprintf("history_~%x", room)
+	}
+	return filepath.Join(dir, name)
+}
+
+// saveMessages appends msgs to the history file in a single write.
+func (r *Room) saveMessages(msgs []Message) {
+	r.historyMu.Lock()
+	defer r.historyMu.Unlock()
+
+	file, err := os.OpenFile(r.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Error("❌ Error saving message", "room", r.name, "err", err)
+		return
+	}
+	defer file.Close()
+
+	// History is stored as one JSON message per line and only
+	// colorized when sent to a client.
+	var lines []byte
+	for _, msg := range msgs {
+		lines = append(append(lines, msg.ToJSON()...), '\n')
+	}
+	_, err = file.Write(lines)
+	if err != nil {
+		slog.Error("❌ Error writing message to file", "room", r.name, "err", err)
+		return
+	}
+
+	r.historyLines += len(msgs)
+	if limit := r.server.cfg.HistoryLimit; limit > 0 && r.historyLines >= 2*limit {
+		if err := r.trimHistory(); err != nil {
+			slog.Error("❌ Error trimming history", "room", r.name, "err", err)
+		}
+	}
+}
+
+// flush saves the sequence number and syncs the history, message ID
+// and sequence number files of the room to disk, so that saved
+// messages survive a crash of the machine.
+func (r *Room) flush() error {
+	r.do(r.saveSeq)
+
+	r.historyMu.Lock()
+	defer r.historyMu.Unlock()
+
+	for _, name := range []string{r.historyFile, r.idFile(), r.seqFile()} {
+		file, err := os.OpenFile(name, os.O_WRONLY, 0)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = file.Sync()
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendHistory sends the recent messages of the room to the client.
+// They are copied under r.mu but written to the client once the lock
+// is released, so that a slow client never holds up the messages being
+// saved meanwhile.
+func (r *Room) sendHistory(client *Client) {
+	if !r.server.cfg.HistoryOnJoin {
+		return
+	}
+	if !r.isLogged() {
+		client.writeMessage([]byte("🙈 Logging is disabled in this room, no history is kept.\n"))
+		return
+	}
+
+	history := r.history(0)
+	if len(history) == 0 {
+		client.writeMessage([]byte("📭 No chat history available.\n"))
+		return
+	}
+
+	if err := client.writeMessage([]byte("📜 Previous messages:\n")); err != nil {
+		return
+	}
+	writeHistory(client, history)
+}
+
+// history returns the last n recent messages that haven't expired,
+// oldest first, or all of them when n is zero.
+func (r *Room) history(n int) []Message {
+	now := time.Now()
+	history := slices.DeleteFunc(r.recentMessages(0), func(msg Message) bool {
+		return msg.expired(now)
+	})
+	if n > 0 && len(history) > n {
+		history = history[len(history)-n:]
+	}
+	return history
+}
+
+// writeHistory writes messages of a room's history to the client.
+func writeHistory(client *Client, history []Message) {
+	for _, msg := range history {
+		// History follows its heading rather than the prompt.
+		rendered := client.server.style.layout(msg.format(client.server.style), false)
+		if err := client.writeRoomMessage(msg, rendered); err != nil {
+			return
+		}
+	}
+}
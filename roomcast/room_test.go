@@ -0,0 +1,515 @@
+package roomcast
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRoomJoinTwice(t *testing.T) {
+	tests := []struct {
+		name  string
+		joins int
+	}{
+		{name: "once", joins: 1},
+		{name: "twice", joins: 2},
+		{name: "three times", joins: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			alice := join(t, server, "alice", "room_one")
+			join(t, server, "bobby", "room_one")
+			alice.expect("bobby has joined the room")
+
+			bobby := clientNamed(t, server, "bobby")
+			room := server.Room("ROOM_ONE")
+			for range tt.joins - 1 {
+				if err := bobby.joinRoom(room); err != nil {
+					t.Fatalf("joining again: %v", err)
+				}
+			}
+
+			if count := room.ClientCount(); count != 2 {
+				t.Errorf("ClientCount = %d, want 2", count)
+			}
+			alice.refute("bobby has joined the room", 300*time.Millisecond)
+		})
+	}
+}
+
+func TestHistoryStaysInHistoryDir(t *testing.T) {
+	tests := []struct {
+		name string
+		room string
+	}{
+		{name: "valid name", room: "ROOM_ONE"},
+		{name: "parent directories", room: "../../etc/passwd"},
+		{name: "parent directory only", room: ".."},
+		{name: "absolute path", room: "/tmp/evil"},
+		{name: "backslashes", room: `..\..\evil`},
+		{name: "not ASCII", room: "SALON_É"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			dir := server.cfg.HistoryDir
+			room, err := server.getOrCreateRoom(tt.room, "alice")
+			if err != nil {
+				t.Fatalf("getOrCreateRoom: %v", err)
+			}
+			if got := filepath.Dir(room.historyFile); got != dir {
+				t.Fatalf("history file %s is outside %s", room.historyFile, dir)
+			}
+			room.forward <- NewMessage("hello", "alice", UserMessageType).ToJSON()
+
+			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+			defer cancel()
+			if err := server.Shutdown(ctx); err != nil {
+				t.Fatalf("Shutdown: %v", err)
+			}
+			if _, err := os.Stat(room.historyFile); err != nil {
+				t.Errorf("history not saved: %v", err)
+			}
+			// The history directory is the only entry of its parent,
+			// created for the test.
+			entries, err := os.ReadDir(filepath.Dir(dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				if entry.Name() != filepath.Base(dir) {
+					t.Errorf("%s written next to the history directory", entry.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestDuplicateUsername(t *testing.T) {
+	tests := []struct {
+		name      string
+		usernames []string
+		rooms     []string
+		admitted  int
+	}{
+		{name: "two clients racing", usernames: []string{"alice", "alice"}, rooms: []string{"room_one", "room_one"}, admitted: 1},
+		{name: "ten clients racing", usernames: slices.Repeat([]string{"alice"}, 10), rooms: slices.Repeat([]string{"room_one"}, 10), admitted: 1},
+		{name: "names differing in case", usernames: []string{"alice", "ALICE"}, rooms: []string{"room_one", "room_one"}, admitted: 1},
+		{name: "different rooms", usernames: []string{"alice", "alice"}, rooms: []string{"room_one", "room_two"}, admitted: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			clients := make([]*testClient, len(tt.usernames))
+			for i := range clients {
+				clients[i] = dial(t, server)
+			}
+			for i, c := range clients {
+				c.expect("Enter username: ")
+				c.send(tt.usernames[i])
+				c.expect("Enter room name: ")
+			}
+			for i, c := range clients {
+				c.send(tt.rooms[i])
+			}
+
+			admitted := 0
+			for i, c := range clients {
+				switch c.expectOneOf(" > ", "username already taken in this room") {
+				case " > ":
+					admitted++
+				default:
+					// The loser keeps its room and picks another name.
+					c.expect("Enter username: ")
+					c.send(fmt.Sprintf("other_%d", i))
+					c.expect(" > ")
+				}
+			}
+			if admitted != tt.admitted {
+				t.Errorf("%d clients admitted with their name, want %d", admitted, tt.admitted)
+			}
+			members := 0
+			for _, name := range slices.Compact(slices.Sorted(slices.Values(tt.rooms))) {
+				members += server.Room(strings.ToUpper(name)).ClientCount()
+			}
+			if members != len(clients) {
+				t.Errorf("%d members in all, want %d", members, len(clients))
+			}
+		})
+	}
+}
+
+func TestRoomCapacity(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		joiners  int
+		admitted int
+	}{
+		{name: "default capacity", joiners: 3, admitted: 3},
+		{name: "room for everyone", capacity: 3, joiners: 3, admitted: 3},
+		{name: "third joiner turned away", capacity: 2, joiners: 3, admitted: 2},
+		{name: "single seat", capacity: 1, joiners: 3, admitted: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			if tt.capacity > 0 {
+				cfg.MaxClients = tt.capacity
+			}
+			server := startServer(t, cfg)
+
+			var members []*testClient
+			for i := range tt.joiners {
+				c := dial(t, server)
+				c.expect("Enter username: ")
+				c.send(fmt.Sprintf("user_%d", i))
+				c.expect("Enter room name: ")
+				c.send("room_one")
+				if i < tt.admitted {
+					c.expect(" > ")
+					members = append(members, c)
+					continue
+				}
+				c.expect("Cannot join ROOM_ONE: room is full.")
+				c.expectClosed()
+			}
+			if n := server.Room("ROOM_ONE").ClientCount(); n != tt.admitted {
+				t.Errorf("ClientCount = %d, want %d", n, tt.admitted)
+			}
+
+			// A seat frees up when a member leaves.
+			members[0].send("/quit")
+			members[0].expectClosed()
+			join(t, server, "carol", "room_one")
+		})
+	}
+}
+
+func TestSlowClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		queue   func(c *Client) chan []byte
+		trigger func(t *testing.T, server *Server) *testClient
+	}{
+		{
+			name:    "forwarded message",
+			content: "message %d",
+			queue:   func(c *Client) chan []byte { return c.send },
+			trigger: func(t *testing.T, server *Server) *testClient {
+				carol := join(t, server, "carol", "room_one")
+				carol.send("one more")
+				return carol
+			},
+		},
+		{
+			name:    "notice",
+			content: "@slowy ping %d",
+			queue:   func(c *Client) chan []byte { return c.urgent },
+			trigger: func(t *testing.T, server *Server) *testClient {
+				return join(t, server, "carol", "room_one")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			// slowy never reads after joining: its writer blocks on the
+			// first message and the rest stays in its queue.
+			slowy := pipe(t, server, func(conn net.Conn) net.Conn { return conn })
+			slowy.setup("slowy", "room_one")
+			alice := join(t, server, "alice", "room_one")
+			room := server.Room("ROOM_ONE")
+			queue := tt.queue(clientNamed(t, server, "slowy"))
+			for i := range cap(queue) + 1 {
+				room.forward <- NewMessage(fmt.Sprintf(tt.content, i), "bobby", UserMessageType).ToJSON()
+			}
+			waitFor(t, "slowy's queue to be full", func() bool { return len(queue) == cap(queue) })
+
+			// The room must drop slowy rather than wait for it, and go
+			// on serving the others.
+			carol := tt.trigger(t, server)
+			alice.expect("slowy has left the room")
+			if room.HasClient("slowy") {
+				t.Error("slowy is still a member")
+			}
+			alice.send("still here")
+			carol.expect("💬 still here")
+		})
+	}
+}
+
+func TestAccessorsDuringChurn(t *testing.T) {
+	tests := []struct {
+		name    string
+		rooms   int
+		clients int
+	}{
+		{name: "one room", rooms: 1, clients: 10},
+		{name: "three rooms", rooms: 3, clients: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			var names []string
+			for i := range tt.rooms {
+				// keepN stays in room_N while the others come and go.
+				join(t, server, fmt.Sprintf("keep%d", i), fmt.Sprintf("room_%d", i))
+				names = append(names, fmt.Sprintf("ROOM_%d", i))
+			}
+
+			// Each churning client joins a room and quits right away.
+			var churn sync.WaitGroup
+			for i := range tt.clients {
+				churn.Add(1)
+				go func() {
+					defer churn.Done()
+					conn, err := net.Dial("tcp", server.Addr().String())
+					if err != nil {
+						t.Errorf("dial: %v", err)
+						return
+					}
+					defer conn.Close()
+					fmt.Fprintf(conn, "churn%02d\nroom_%d\n/quit\n", i, i%tt.rooms)
+					conn.SetReadDeadline(time.Now().Add(testTimeout))
+					io.Copy(io.Discard, conn)
+				}()
+			}
+			churned := make(chan struct{})
+			go func() {
+				churn.Wait()
+				close(churned)
+			}()
+
+			for done := false; !done; {
+				select {
+				case <-churned:
+					done = true
+				default:
+				}
+				if got := server.RoomNames(); !slices.Equal(got, names) {
+					t.Fatalf("RoomNames = %v, want %v", got, names)
+				}
+				if got := server.RoomCount(); got != tt.rooms {
+					t.Fatalf("RoomCount = %d, want %d", got, tt.rooms)
+				}
+				for i, name := range names {
+					room := server.Room(name)
+					if n := room.ClientCount(); n < 1 || n > 1+tt.clients {
+						t.Fatalf("%s ClientCount = %d during the churn", name, n)
+					}
+					if !room.HasClient(fmt.Sprintf("keep%d", i)) {
+						t.Fatalf("%s lost keep%d", name, i)
+					}
+				}
+			}
+
+			for i, name := range names {
+				room := server.Room(name)
+				waitFor(t, name+" to empty", func() bool { return room.ClientCount() == 1 })
+				for j := range tt.clients {
+					if room.HasClient(fmt.Sprintf("churn%02d", j)) {
+						t.Errorf("churn%02d is still in %s", j, name)
+					}
+				}
+				if !room.HasClient(fmt.Sprintf("keep%d", i)) {
+					t.Errorf("%s lost keep%d", name, i)
+				}
+			}
+		})
+	}
+}
+
+func TestServerRoom(t *testing.T) {
+	server := startServer(t, DefaultConfig())
+	join(t, server, "alice", "room_one")
+
+	tests := []struct {
+		name   string
+		room   string
+		exists bool
+	}{
+		{name: "upper case", room: "ROOM_ONE", exists: true},
+		{name: "lower case", room: "room_one", exists: true},
+		{name: "not open", room: "room_two"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			room := server.Room(tt.room)
+			if !tt.exists {
+				if room != nil {
+					t.Fatalf("Room(%q) = %s, want nil", tt.room, room.name)
+				}
+				return
+			}
+			if room == nil {
+				t.Fatalf("Room(%q) = nil", tt.room)
+			}
+			if n := room.ClientCount(); n != 1 {
+				t.Errorf("ClientCount = %d, want 1", n)
+			}
+			if !room.HasClient("alice") {
+				t.Error("HasClient(alice) = false")
+			}
+		})
+	}
+}
+
+func TestTwoRooms(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, alice, bobby, carol *testClient)
+	}{
+		{
+			name: "tagged message",
+			run: func(t *testing.T, alice, bobby, carol *testClient) {
+				alice.send("#room_one hi there")
+				bobby.expect("🤖 alice 💬 hi there")
+				carol.refute("hi there", 200*time.Millisecond)
+			},
+		},
+		{
+			name: "untagged message",
+			run: func(t *testing.T, alice, bobby, carol *testClient) {
+				alice.send("hello")
+				carol.expect("🤖 alice 💬 hello")
+				bobby.refute("hello", 200*time.Millisecond)
+			},
+		},
+		{
+			name: "hashtag",
+			run: func(t *testing.T, alice, bobby, carol *testClient) {
+				alice.send("#golang rocks")
+				carol.expect("🤖 alice 💬 #golang rocks")
+				bobby.refute("rocks", 200*time.Millisecond)
+			},
+		},
+		{
+			name: "tag without text",
+			run: func(t *testing.T, alice, bobby, carol *testClient) {
+				alice.send("#room_one")
+				carol.expect("🤖 alice 💬 #room_one")
+				bobby.refute("#room_one", 200*time.Millisecond)
+			},
+		},
+		{
+			name: "incoming messages are tagged",
+			run: func(t *testing.T, alice, bobby, carol *testClient) {
+				bobby.send("from one")
+				if out := alice.expect("💬 from one"); !strings.Contains(out, "[ROOM_ONE]"+ColorReset) {
+					t.Errorf("message from ROOM_ONE = %q, want it tagged", out)
+				}
+				carol.send("from two")
+				if out := alice.expect("💬 from two"); !strings.Contains(out, "[ROOM_TWO]"+ColorReset) {
+					t.Errorf("message from ROOM_TWO = %q, want it tagged", out)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			bobby := join(t, server, "bobby", "room_one")
+			carol := join(t, server, "carol", "room_two")
+			alice := join(t, server, "alice", "room_one")
+			bobby.expect("alice has joined the room")
+			alice.send("/join room_two")
+			alice.expect("alice 🏠 ROOM_TWO" + ColorReset + " > ")
+			carol.expect("alice has joined the room")
+
+			tt.run(t, alice, bobby, carol)
+		})
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxClients int
+		run        func(t *testing.T, server *Server, alice, bobby, carol *testClient)
+	}{
+		{
+			name: "new room",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/switch room_two")
+				alice.expect("💬 earlier")
+				alice.expect("alice 🏠 ROOM_TWO" + ColorReset + " > ")
+				carol.expect("alice has joined the room")
+				bobby.expect("alice has left the room")
+				if server.Room("ROOM_ONE").HasClient("alice") {
+					t.Error("alice is still in ROOM_ONE")
+				}
+
+				alice.send("hi")
+				carol.expect("🤖 alice 💬 hi")
+				bobby.refute("hi", 200*time.Millisecond)
+			},
+		},
+		{
+			name: "room already joined",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/join room_two")
+				alice.expect("alice 🏠 ROOM_TWO" + ColorReset + " > ")
+				alice.send("/switch room_one")
+				alice.expect("alice 🏠 ROOM_ONE" + ColorReset + " > ")
+				if !server.Room("ROOM_TWO").HasClient("alice") {
+					t.Error("alice left ROOM_TWO")
+				}
+
+				alice.send("hi")
+				bobby.expect("🤖 alice 💬 hi")
+				carol.refute("hi", 200*time.Millisecond)
+			},
+		},
+		{
+			name:       "full room",
+			maxClients: 2,
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/switch room_two")
+				alice.expect("room is full")
+
+				alice.send("hi")
+				bobby.expect("🤖 alice 💬 hi")
+				carol.refute("alice", 200*time.Millisecond)
+			},
+		},
+		{
+			name: "invalid room name",
+			run: func(t *testing.T, server *Server, alice, bobby, carol *testClient) {
+				alice.send("/switch r")
+				alice.expect("Usage: /switch <room>")
+
+				alice.send("hi")
+				bobby.expect("🤖 alice 💬 hi")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			if tt.maxClients > 0 {
+				cfg.MaxClients = tt.maxClients
+			}
+			server := startServer(t, cfg)
+			carol := join(t, server, "carol", "room_two")
+			david := join(t, server, "david", "room_two")
+			carol.send("earlier")
+			david.expect("💬 earlier")
+			bobby := join(t, server, "bobby", "room_one")
+			alice := join(t, server, "alice", "room_one")
+			bobby.expect("alice has joined the room")
+
+			tt.run(t, server, alice, bobby, carol)
+		})
+	}
+}
@@ -0,0 +1,649 @@
+package roomcast
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Server struct {
+	// listener is the TCP listener used to accept incoming connections.
+	listener net.Listener
+
+	// cfg holds the server settings.
+	cfg Config
+
+	// usernamePattern and roomNamePattern are the compiled
+	// Config.UsernamePattern and Config.RoomNamePattern.
+	usernamePattern *regexp.Regexp
+	roomNamePattern *regexp.Regexp
+
+	// style holds the display settings messages are formatted with.
+	style textStyle
+
+	// tls encrypts client connections when set; they are plain TCP
+	// otherwise.
+	tls *tls.Config
+
+	// rooms stores all active rooms by name.
+	rooms map[string]*Room
+
+	// clients stores every connected client, whichever rooms they are in.
+	clients map[*Client]struct{}
+
+	// lastRooms holds the room each ip/username pair was last in,
+	// for /rejoin.
+	lastRooms map[string]lastRoom
+
+	// passwordFailures counts the wrong room passwords of each
+	// ip/room pair, see tryPassword.
+	passwordFailures map[string]passwordFailures
+
+	// connsPerIP counts the open client connections of each IP address
+	// when Config.MaxConnsPerIP is set.
+	connsPerIP map[string]int
+
+	// fedListener accepts links from peer servers, and peers holds the
+	// established links. fedID tells this server apart from its peers
+	// in the federation handshake.
+	fedListener net.Listener
+	peers       map[*peerLink]struct{}
+	fedID       string
+
+	// wsListener accepts WebSocket clients when Config.WSAddr is set.
+	wsListener net.Listener
+
+	// adminListener serves the admin endpoint when Config.AdminAddr
+	// is set, and metricsListener the metrics when Config.MetricsAddr is.
+	adminListener   net.Listener
+	metricsListener net.Listener
+
+	// ctx is canceled once Shutdown has been called, which stops the
+	// rooms and aborts the connections still being set up.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// events publishes the connection lifecycle events.
+	events chan Event
+
+	// started is when the server was created, forwarded counts the
+	// messages forwarded by all rooms and peakClients is the highest
+	// number of clients connected at once.
+	started     time.Time
+	forwarded   atomic.Int64
+	peakClients int
+
+	// metrics holds the Prometheus metrics served on Config.MetricsAddr.
+	metrics *metrics
+
+	// reports holds the messages flagged by users for moderator review.
+	reports []Report
+
+	// mu is a mutex used to synchronize access to shared resources like rooms map.
+	mu sync.RWMutex
+}
+
+// NewServer creates a server with the given settings, usually
+// DefaultConfig with some fields changed. Fields left at zero get their
+// default when zero has no meaning of its own. It returns an error if a
+// setting is invalid or the TLS certificate can't be loaded.
+func NewServer(cfg Config) (*Server, error) {
+	if err := cfg.normalize(); err != nil {
+		return nil, err
+	}
+	usernamePattern, roomNamePattern, err := compileNamePatterns(cfg.UsernamePattern, cfg.RoomNamePattern)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := loadTLSConfig(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		ctx:        ctx,
+		cancel:     cancel,
+		rooms:      make(map[string]*Room),
+		clients:    make(map[*Client]struct{}),
+		lastRooms:  make(map[string]lastRoom),
+		connsPerIP: make(map[string]int),
+		peers:      make(map[*peerLink]struct{}),
+		fedID:      rand.Text(),
+		events:     make(chan Event, cfg.EventBuffer),
+		started:    time.Now(),
+		metrics:    newMetrics(),
+		cfg:        cfg,
+		tls:        tlsConfig,
+
+		passwordFailures: make(map[string]passwordFailures),
+		usernamePattern:  usernamePattern,
+		roomNamePattern:  roomNamePattern,
+		style:            textStyle{spacing: cfg.LineSpacing, nameWidth: cfg.NameDisplayWidth},
+	}, nil
+}
+
+// maxAcceptDelay caps the back-off after temporary Accept errors.
+const maxAcceptDelay = time.Second
+
+// Start begins listening for client connections. It returns nil once
+// the server is shut down, or an error if the listener fails. The
+// server also shuts down when ctx is done; call Shutdown instead to
+// bound how long that takes.
+func (srv *Server) Start(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() { srv.Shutdown(context.Background()) })
+	defer stop()
+
+	if err := os.MkdirAll(srv.cfg.HistoryDir, 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", srv.cfg.Port))
+	if err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+	srv.mu.Lock()
+	srv.listener = ln
+	srv.mu.Unlock()
+	if srv.tls != nil {
+		slog.Info("✅ Server started", "addr", ln.Addr(), "tls", true)
+	} else {
+		slog.Info("✅ Server started", "addr", ln.Addr())
+	}
+
+	if err := srv.startFederation(); err != nil {
+		ln.Close()
+		return err
+	}
+	if err := srv.startWebSocket(); err != nil {
+		ln.Close()
+		return err
+	}
+	if err := srv.startAdminHTTP(); err != nil {
+		ln.Close()
+		return err
+	}
+	if err := srv.startMetrics(); err != nil {
+		ln.Close()
+		return err
+	}
+
+	var delay time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if srv.isShuttingDown() {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return fmt.Errorf("listener closed unexpectedly: %w", err)
+			}
+
+			// Other errors, such as running out of file descriptors,
+			// are usually temporary: back off and try again.
+			delay = min(max(2*delay, 5*time.Millisecond), maxAcceptDelay)
+			slog.Error("🚨 Accept error", "err", err, "retry", delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		go srv.handleConnection(conn)
+	}
+}
+
+// Addr returns the address the server accepts clients on, or nil until
+// Start is listening. With Config.Port set to zero, it tells which port
+// was picked.
+func (srv *Server) Addr() net.Addr {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	if srv.listener == nil {
+		return nil
+	}
+	return srv.listener.Addr()
+}
+
+// handleConnection manages a new client connection.
+func (s *Server) handleConnection(conn net.Conn) {
+	s.metrics.connections.Inc()
+	// Count the connection before reading its PROXY header or paying
+	// for its TLS handshake. Whichever wrapper closes it later releases
+	// the slot.
+	conn, allowed := s.countConn(conn)
+	if !allowed {
+		s.refuseConn(conn)
+		return
+	}
+	// Abort the setup if the server shuts down meanwhile; once admitted,
+	// the client is disconnected by its rooms.
+	stop := context.AfterFunc(s.ctx, func() { conn.Close() })
+	defer stop()
+	setKeepAlive(conn, s.cfg.KeepAlivePeriod)
+	reader := bufio.NewReader(conn)
+	if s.cfg.ProxyProtocol {
+		proxied, err := readProxyHeader(conn, reader)
+		if err != nil {
+			slog.Warn("🚨 Rejected connection", "addr", conn.RemoteAddr(), "err", err)
+			conn.Close()
+			return
+		}
+		// The slot was taken for the load balancer's address.
+		if !s.recountConn(conn, remoteIP(proxied)) {
+			s.refuseConn(proxied)
+			return
+		}
+		conn = proxied
+	}
+	if s.tls != nil {
+		secured, err := startTLS(conn, reader, s.tls)
+		if err != nil {
+			slog.Warn("🚨 Rejected connection", "addr", conn.RemoteAddr(), "err", err)
+			conn.Close()
+			return
+		}
+		conn = secured
+	}
+	if s.cfg.Protocol == protocolFramed {
+		conn = &framedConn{Conn: conn, caps: capabilities{emoji: true, framing: true}}
+	}
+	remoteAddr := conn.RemoteAddr().String()
+	s.emit(Event{Type: EventClientConnected, RemoteAddr: remoteAddr})
+
+	// Get valid username and room name
+	s.setSetupDeadline(conn)
+	conn, username, roomName, err := s.setupClient(conn, reader)
+	if err == nil {
+		err = s.askRoomPassword(conn, reader, roomName)
+	}
+	for err == nil {
+		conn.SetReadDeadline(time.Time{})
+		err = s.admit(conn, reader, username, roomName)
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, errNameTaken) {
+			break
+		}
+
+		// Ask for another name, keeping the room
+		s.setSetupDeadline(conn)
+		conn, username, err = s.askUsername(conn, reader)
+	}
+
+	if isTimeout(err) {
+		s.writeSetupError(conn, CodeTimeout, fmt.Sprintf("No answer within %v, disconnecting.", s.cfg.SetupTimeout))
+	}
+	slog.Warn("🚨 Failed to setup client", "err", err)
+	conn.Close()
+	s.emit(Event{Type: EventClientDisconnected, Username: username, RemoteAddr: remoteAddr})
+}
+
+// refuseConn turns away a connection over Config.MaxConnsPerIP. With
+// TLS, it is closed without a word rather than after a handshake.
+func (s *Server) refuseConn(conn net.Conn) {
+	slog.Warn("🚨 Rejected connection", "addr", conn.RemoteAddr(), "err", "too many connections from its address")
+	if s.tls == nil {
+		if s.cfg.Protocol == protocolFramed {
+			conn = &framedConn{Conn: conn, caps: capabilities{emoji: true, framing: true}}
+		}
+		s.writeSetupError(conn, CodeLimitReached, fmt.Sprintf("Too many connections from your address (at most %d), disconnecting.", s.cfg.MaxConnsPerIP))
+	}
+	conn.Close()
+}
+
+// setSetupDeadline gives the client Config.SetupTimeout to answer the
+// setup prompts, so connections that never do are released.
+func (s *Server) setSetupDeadline(conn net.Conn) {
+	if s.cfg.SetupTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(s.cfg.SetupTimeout))
+	}
+}
+
+// admit creates the client of a connection whose username and room
+// name have been validated, joins it to the room and starts serving it.
+// If the room refuses the client, the error is written to the client
+// and returned, and the caller is left to close conn.
+func (s *Server) admit(conn net.Conn, reader *bufio.Reader, username, roomName string) error {
+	room, err := s.getOrCreateRoom(roomName, username)
+	if err != nil {
+		s.writeSetupError(conn, CodeLimitReached, fmt.Sprintf("Cannot create %s: %v.", roomName, err))
+		return err
+	}
+
+	client := newClient(conn, reader, username, s)
+
+	if err := client.joinRoom(room); err != nil {
+		client.writeError(joinErrorCode(err), fmt.Sprintf("Cannot join %s: %v.", room.name, err))
+		return err
+	}
+
+	room.sendHistory(client)
+	room.sendTopic(client)
+	room.sendMotd(client)
+
+	s.addClient(client)
+
+	go client.read()
+	go client.write()
+	if s.cfg.Heartbeat > 0 {
+		go client.heartbeat()
+	}
+	return nil
+}
+
+func (s *Server) isShuttingDown() bool {
+	return s.ctx.Err() != nil
+}
+
+// addClient registers a connected client on the server.
+func (s *Server) addClient(client *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[client] = struct{}{}
+	s.metrics.clients.Inc()
+	if len(s.clients) > s.peakClients {
+		s.peakClients = len(s.clients)
+	}
+}
+
+// removeClient unregisters a disconnected client.
+func (s *Server) removeClient(client *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[client]; ok {
+		delete(s.clients, client)
+		s.metrics.clients.Dec()
+	}
+}
+
+// admins returns the connected clients that have admin rights.
+func (s *Server) admins() []*Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var admins []*Client
+	for client := range s.clients {
+		if client.isAdmin() {
+			admins = append(admins, client)
+		}
+	}
+	return admins
+}
+
+// getOrCreateRoom finds an existing room or creates a new one on
+// behalf of username. Creating a room fails with errTooManyRooms when
+// username already created Config.MaxRoomsPerUser rooms. The count and
+// the new room are taken under the same lock, so concurrent creations
+// can't both slip under the limit.
+func (s *Server) getOrCreateRoom(name, username string) (*Room, error) {
+	s.mu.Lock()
+	if room, exist := s.rooms[name]; exist {
+		s.mu.Unlock()
+		return room, nil
+	}
+	if limit := s.cfg.MaxRoomsPerUser; limit > 0 && s.roomsCreatedBy(username) >= limit {
+		s.mu.Unlock()
+		return nil, errTooManyRooms
+	}
+
+	// Create a new room if no available space
+	room := newRoom(name, s)
+	room.color = getRandomColor(s.roomColorsInUse())
+	room.createdBy = username
+
+	s.rooms[name] = room
+	s.metrics.rooms.Inc()
+	go room.run()
+	s.mu.Unlock()
+
+	// Emitted once the lock is released, so that waiting for the
+	// consumer doesn't hold up every other lookup.
+	slog.Info("🏠 Room created", "room", name)
+	s.emit(Event{Type: EventRoomCreated, Room: name})
+	return room, nil
+}
+
+// roomsCreatedBy counts the open rooms username created, whether or not
+// they still have members: rooms stay open until the server stops, so
+// leaving one doesn't make room for another. s.mu must be held.
+func (s *Server) roomsCreatedBy(username string) int {
+	count := 0
+	for _, room := range s.rooms {
+		if room.createdBy == username {
+			count++
+		}
+	}
+	return count
+}
+
+// RoomNames returns the names of the open rooms, sorted.
+func (s *Server) RoomNames() []string {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.rooms))
+	for name := range s.rooms {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// RoomCount returns the number of open rooms.
+func (s *Server) RoomCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.rooms)
+}
+
+// Room returns the open room with the given name, in any case, or nil.
+// Its ClientCount and HasClient methods can then be called from any
+// goroutine.
+func (s *Server) Room(name string) *Room {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rooms[strings.ToUpper(name)]
+}
+
+// roomColorsInUse counts the rooms using each color. s.mu must be held.
+func (s *Server) roomColorsInUse() map[string]int {
+	used := make(map[string]int, len(roomColors))
+	for _, room := range s.rooms {
+		used[room.color]++
+	}
+	return used
+}
+
+// Shutdown gracefully shuts down the server: it stops accepting
+// connections, aborts those still being set up and stops every room,
+// then waits for the rooms to disconnect their members. It returns
+// ctx's error if ctx is done before all the rooms have stopped.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	slog.Info("⚠️ Shutting down server...")
+	srv.cancel()
+
+	// Close all rooms
+	srv.mu.Lock()
+	if srv.listener != nil {
+		srv.listener.Close()
+	}
+	if srv.fedListener != nil {
+		srv.fedListener.Close()
+	}
+	if srv.wsListener != nil {
+		srv.wsListener.Close()
+	}
+	if srv.adminListener != nil {
+		srv.adminListener.Close()
+	}
+	if srv.metricsListener != nil {
+		srv.metricsListener.Close()
+	}
+	rooms := make([]*Room, 0, len(srv.rooms))
+	for name, room := range srv.rooms {
+		room.stop()
+		rooms = append(rooms, room)
+		delete(srv.rooms, name)
+		srv.metrics.rooms.Dec()
+	}
+	for link := range srv.peers {
+		link.conn.Close()
+	}
+	srv.mu.Unlock()
+
+	for _, room := range rooms {
+		select {
+		case <-room.done:
+		case <-ctx.Done():
+			return fmt.Errorf("room %s did not stop in time: %w", room.name, ctx.Err())
+		}
+	}
+	// slog.Info("✅ Server shut down gracefully.")
+	return nil
+}
+
+// setupClient prompts the user until a valid username and room name are entered.
+// A line client may answer the username prompt with compressCommand to switch
+// to a compressed stream, in which case the returned connection must be
+// used from then on, along with reader which now reads decompressed data.
+func (s *Server) setupClient(conn net.Conn, reader *bufio.Reader) (net.Conn, string, string, error) {
+	// send Welcome Message
+	if err := sendWelcomeMessage(conn); err != nil {
+		slog.Warn("🚨 Failed to send welcome message", "err", err)
+		return conn, "", "", err
+	}
+
+	conn, username, err := s.askUsername(conn, reader)
+	if err != nil {
+		return conn, "", "", err
+	}
+
+	// Offer to go back to the last room used from this address
+	ip := remoteIP(conn)
+	if last, ok := s.lastRoomOf(ip, username); ok {
+		conn.Write([]byte(fmt.Sprintf("↩️ Type %s to go back to %s.\n", rejoinCommand, last)))
+	}
+
+	// Keep asking for room name until it's valid
+	var roomName string
+	framed := isFramed(conn)
+	for {
+		conn.Write([]byte("Enter room name: "))
+		input, err := readLine(reader, framed)
+		if isFrameError(err) {
+			s.writeSetupError(conn, CodeUsage, fmt.Sprintf("Message rejected: %v.", err))
+			continue
+		}
+		if err != nil {
+			return conn, "", "", fmt.Errorf("error reading room name: %w", err)
+		}
+		roomName = strings.TrimSpace(string(input))
+
+		if roomName == rejoinCommand {
+			last, ok := s.lastRoomOf(ip, username)
+			if !ok {
+				s.writeSetupError(conn, CodeNotFound, "No recent room to rejoin.")
+				continue
+			}
+			roomName = last
+		}
+
+		if s.isValidRoomName(roomName) {
+			break
+		}
+		s.writeSetupError(conn, CodeInvalidName, fmt.Sprintf("Invalid room name. Must be %s.", s.roomNameRules()))
+	}
+
+	return conn, username, strings.ToUpper(roomName), nil
+}
+
+// askUsername prompts the user until a valid username is entered and
+// returns it lowercased, along with the connection to use from then on.
+func (s *Server) askUsername(conn net.Conn, reader *bufio.Reader) (net.Conn, string, error) {
+	var username string
+	for {
+		framed := isFramed(conn)
+		conn.Write([]byte("Enter username: "))
+		input, err := readLine(reader, framed)
+		if isFrameError(err) {
+			s.writeSetupError(conn, CodeUsage, fmt.Sprintf("Message rejected: %v.", err))
+			continue
+		}
+		if err != nil {
+			return conn, "", fmt.Errorf("error reading username: %w", err)
+		}
+		username = strings.TrimSpace(string(input))
+
+		if username == compressCommand && !isCompressed(conn) && !framed {
+			conn.Write([]byte("✅ COMPRESS zlib\n"))
+			conn = compress(conn, reader)
+			continue
+		}
+		if list, ok := strings.CutPrefix(strings.ToLower(username), capsPrefix); ok {
+			conn = negotiate(conn, list)
+			continue
+		}
+
+		if s.isValidUsername(username) {
+			break
+		}
+		s.writeSetupError(conn, CodeInvalidName, fmt.Sprintf("Invalid username. Must be %s.", s.usernameRules()))
+	}
+
+	return conn, strings.ToLower(username), nil
+}
+
+// writeSetupError writes an error to a connection that has no client
+// yet, as an Error message when the connection is a transport.
+func (s *Server) writeSetupError(conn net.Conn, code, text string) {
+	msg := newError(code, text)
+	if t, ok := conn.(transport); ok {
+		t.writeMessage(msg, msg.formatAndConvertToBytes(s.style))
+		return
+	}
+	conn.Write(msg.formatAndConvertToBytes(s.style))
+}
+
+func sendWelcomeMessage(conn net.Conn) error {
+	logo := `
+	▒█▀▀█ ▒█▀▀▀█ ▒█▀▀▀█ ▒█▀▄▀█ 　 ▒█▀▀█ ░█▀▀█ ▒█▀▀▀█ ▀▀█▀▀ 
+	▒█▄▄▀ ▒█░░▒█ ▒█░░▒█ ▒█▒█▒█ 　 ▒█░░░ ▒█▄▄█ ░▀▀▀▄▄ ░▒█░░ 
+	▒█░▒█ ▒█▄▄▄█ ▒█▄▄▄█ ▒█░░▒█ 　 ▒█▄▄█ ▒█░▒█ ▒█▄▄▄█ ░▒█░░ 
+ `
+	_, err := conn.Write([]byte(logo))
+	if err != nil {
+		return err
+	}
+
+	welcomeLines := []string{
+		"🚀 Get ready for an awesome chat experience! 🚀\n",
+		"💡 Broadcasting Live: Join the fun! 🎤 💡\n",
+		"👉 To get started, please enter your username. 👈\n",
+	}
+
+	// Stop at the first failed write, before sleeping, so clients that
+	// drop mid-banner (scanners, health checks) are released promptly.
+	for i, line := range welcomeLines {
+		if _, err = conn.Write([]byte(line)); err != nil {
+			return err
+		}
+		if i < len(welcomeLines)-1 {
+			time.Sleep(200 * time.Millisecond) // Adds a cool typing effect
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,553 @@
+package roomcast
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testTimeout bounds how long a test waits for the server.
+const testTimeout = 5 * time.Second
+
+// startServer starts a server with cfg on a free port, keeping its
+// history in a temporary directory, and shuts it down when the test ends.
+func startServer(t *testing.T, cfg Config) *Server {
+	t.Helper()
+	cfg.Port = 0
+	cfg.HistoryDir = t.TempDir()
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	started := make(chan error, 1)
+	go func() { started <- server.Start(context.Background()) }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("Shutdown: %v", err)
+		}
+		if err := <-started; err != nil {
+			t.Errorf("Start: %v", err)
+		}
+	})
+
+	deadline := time.Now().Add(testTimeout)
+	for server.Addr() == nil {
+		select {
+		case err := <-started:
+			t.Fatalf("Start: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server didn't start listening")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return server
+}
+
+// testClient is a TCP client of a test server, reading its output as
+// plain text.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+
+	// pending holds the output read but not matched yet.
+	pending []byte
+}
+
+// dial connects a client to server, closed when the test ends.
+func dial(t *testing.T, server *Server) *testClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn}
+}
+
+// pipe connects a client to server through net.Pipe, the server's end
+// being wrapped by wrap, and closes it when the test ends.
+func pipe(t *testing.T, server *Server, wrap func(net.Conn) net.Conn) *testClient {
+	t.Helper()
+	clientEnd, serverEnd := net.Pipe()
+	t.Cleanup(func() { clientEnd.Close() })
+	go server.handleConnection(wrap(serverEnd))
+	return &testClient{t: t, conn: clientEnd}
+}
+
+// join connects a client to server and goes through the setup prompts,
+// returning once the client is in the room and its prompt is drawn.
+func join(t *testing.T, server *Server, username, room string) *testClient {
+	t.Helper()
+	c := dial(t, server)
+	c.setup(username, room)
+	return c
+}
+
+// setup answers the setup prompts and returns the output up to the
+// client's first prompt.
+func (c *testClient) setup(username, room string) string {
+	c.t.Helper()
+	c.expect("Enter username: ")
+	c.send(username)
+	c.expect("Enter room name: ")
+	c.send(room)
+	return c.expect(" > ")
+}
+
+// send writes a line to the server.
+func (c *testClient) send(line string) {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(line + "\n")); err != nil {
+		c.t.Fatalf("send %q: %v", line, err)
+	}
+}
+
+// expect reads until want shows up in the output and returns the
+// output up to and including it.
+func (c *testClient) expect(want string) string {
+	c.t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for {
+		if i := bytes.Index(c.pending, []byte(want)); i >= 0 {
+			out := string(c.pending[:i+len(want)])
+			c.pending = c.pending[i+len(want):]
+			return out
+		}
+		if err := c.read(deadline); err != nil {
+			c.t.Fatalf("waiting for %q: %v, got %q", want, err, c.pending)
+		}
+	}
+}
+
+// expectOneOf reads until one of wants shows up in the output, and
+// returns the first one found, consuming the output up to it.
+func (c *testClient) expectOneOf(wants ...string) string {
+	c.t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for {
+		first, at := "", -1
+		for _, want := range wants {
+			if i := bytes.Index(c.pending, []byte(want)); i >= 0 && (at < 0 || i < at) {
+				first, at = want, i
+			}
+		}
+		if at >= 0 {
+			c.pending = c.pending[at+len(first):]
+			return first
+		}
+		if err := c.read(deadline); err != nil {
+			c.t.Fatalf("waiting for one of %q: %v, got %q", wants, err, c.pending)
+		}
+	}
+}
+
+// refute reads for wait and fails if unwanted shows up in the output.
+func (c *testClient) refute(unwanted string, wait time.Duration) {
+	c.t.Helper()
+	deadline := time.Now().Add(wait)
+	for {
+		err := c.read(deadline)
+		if bytes.Contains(c.pending, []byte(unwanted)) {
+			c.t.Fatalf("unexpected %q in %q", unwanted, c.pending)
+		}
+		if err != nil {
+			c.pending = nil
+			return
+		}
+	}
+}
+
+// expectClosed reads until the server closes the connection.
+func (c *testClient) expectClosed() {
+	c.t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for {
+		err := c.read(deadline)
+		if isTimeout(err) {
+			c.t.Fatalf("connection still open, got %q", c.pending)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// read appends what the server sent next to pending.
+func (c *testClient) read(deadline time.Time) error {
+	c.conn.SetReadDeadline(deadline)
+	buf := make([]byte, 4096)
+	n, err := c.conn.Read(buf)
+	c.pending = append(c.pending, buf[:n]...)
+	return err
+}
+
+// waitFor polls cond until it holds, failing the test after testTimeout.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNewServerPort(t *testing.T) {
+	tests := []struct {
+		name    string
+		port    int
+		wantErr bool
+	}{
+		{name: "zero picks a free port", port: 0},
+		{name: "negative", port: -1, wantErr: true},
+		{name: "above 65535", port: 65536, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Port = tt.port
+			cfg.HistoryDir = t.TempDir()
+			server, err := NewServer(cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewServer with port %d succeeded", tt.port)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			if server.Addr() != nil {
+				t.Fatalf("Addr before Start = %v, want nil", server.Addr())
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			started := make(chan error, 1)
+			go func() { started <- server.Start(ctx) }()
+			waitFor(t, "the server to listen", func() bool { return server.Addr() != nil })
+
+			port := server.Addr().(*net.TCPAddr).Port
+			if port == 0 || port == defaultPort {
+				t.Errorf("listening on port %d, want a free port", port)
+			}
+			c := &testClient{t: t}
+			if c.conn, err = net.Dial("tcp", server.Addr().String()); err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer c.conn.Close()
+			c.expect("Enter username: ")
+
+			cancel()
+			select {
+			case err := <-started:
+				if err != nil {
+					t.Errorf("Start: %v", err)
+				}
+			case <-time.After(testTimeout):
+				t.Fatal("Start didn't return after its context was canceled")
+			}
+		})
+	}
+}
+
+// clientNamed returns the connected client called username.
+func clientNamed(t *testing.T, server *Server, username string) *Client {
+	t.Helper()
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	for client := range server.clients {
+		if client.name() == username {
+			return client
+		}
+	}
+	t.Fatalf("no client called %s", username)
+	return nil
+}
+
+func TestMaxRoomsPerUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		limit      int
+		creations  int
+		concurrent bool
+		want       int
+	}{
+		{name: "no limit", limit: 0, creations: 5, want: 5},
+		{name: "under the limit", limit: 3, creations: 2, want: 2},
+		{name: "empty rooms count", limit: 2, creations: 5, want: 2},
+		{name: "concurrent creations", limit: 3, creations: 10, concurrent: true, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.MaxRoomsPerUser = tt.limit
+			server := startServer(t, cfg)
+
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			created := 0
+			for i := range tt.creations {
+				create := func() {
+					_, err := server.getOrCreateRoom(fmt.Sprintf("ROOM_%d", i), "alice")
+					if err != nil && !errors.Is(err, errTooManyRooms) {
+						t.Errorf("getOrCreateRoom: %v", err)
+					}
+					if err == nil {
+						mu.Lock()
+						created++
+						mu.Unlock()
+					}
+				}
+				if tt.concurrent {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						create()
+					}()
+				} else {
+					create()
+				}
+			}
+			wg.Wait()
+
+			if created != tt.want {
+				t.Errorf("created %d rooms, want %d", created, tt.want)
+			}
+			// Joining rooms someone else created is never limited
+			if _, err := server.getOrCreateRoom("ROOM_0", "bobby"); err != nil {
+				t.Errorf("getting an existing room: %v", err)
+			}
+		})
+	}
+}
+
+func TestUsernameLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max int
+		username string
+		valid    bool
+		wantErr  bool
+	}{
+		{name: "default minimum", username: "alice", valid: true},
+		{name: "default maximum", username: "alice_12", valid: true},
+		{name: "too short by default", username: "abcd"},
+		{name: "too long by default", username: "alice_123"},
+		{name: "configured minimum", min: 3, max: 15, username: "bob", valid: true},
+		{name: "configured maximum", min: 3, max: 15, username: "alice_123456789", valid: true},
+		{name: "too short when configured", min: 3, max: 15, username: "bo"},
+		{name: "too long when configured", min: 3, max: 15, username: "alice_1234567890"},
+		{name: "negative minimum", min: -1, max: 8, wantErr: true},
+		{name: "maximum below minimum", min: 6, max: 5, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			if tt.min != 0 {
+				cfg.MinUsernameLength, cfg.MaxUsernameLength = tt.min, tt.max
+			}
+			if tt.wantErr {
+				cfg.HistoryDir = t.TempDir()
+				if _, err := NewServer(cfg); err == nil {
+					t.Fatalf("NewServer accepted usernames of %d-%d characters", tt.min, tt.max)
+				}
+				return
+			}
+			server := startServer(t, cfg)
+
+			c := dial(t, server)
+			c.expect("Enter username: ")
+			c.send(tt.username)
+			if tt.valid {
+				c.expect("Enter room name: ")
+				return
+			}
+			want := fmt.Sprintf("Invalid username. Must be %d-%d characters", cfg.MinUsernameLength, cfg.MaxUsernameLength)
+			c.expect(want)
+			c.expect("Enter username: ")
+		})
+	}
+}
+
+func TestStartReturns(t *testing.T) {
+	tests := []struct {
+		name    string
+		stop    func(server *Server, cancel context.CancelFunc)
+		wantErr error
+	}{
+		{
+			name: "Shutdown",
+			stop: func(server *Server, cancel context.CancelFunc) {
+				server.Shutdown(context.Background())
+			},
+		},
+		{
+			name: "context canceled",
+			stop: func(server *Server, cancel context.CancelFunc) { cancel() },
+		},
+		{
+			name: "listener closed unexpectedly",
+			stop: func(server *Server, cancel context.CancelFunc) {
+				server.mu.RLock()
+				defer server.mu.RUnlock()
+				server.listener.Close()
+			},
+			wantErr: net.ErrClosed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Port = 0
+			cfg.HistoryDir = t.TempDir()
+			server, err := NewServer(cfg)
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			started := make(chan error, 1)
+			go func() { started <- server.Start(ctx) }()
+			waitFor(t, "the server to listen", func() bool { return server.Addr() != nil })
+			join(t, server, "alice", "room_one")
+
+			tt.stop(server, cancel)
+			select {
+			case err := <-started:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Start = %v, want %v", err, tt.wantErr)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Start didn't return")
+			}
+			server.Shutdown(context.Background())
+		})
+	}
+}
+
+func TestSetupTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		answer  []string
+		closed  bool
+	}{
+		{name: "silent connection", timeout: time.Second, closed: true},
+		{name: "silent after the username", timeout: time.Second, answer: []string{"alice"}, closed: true},
+		{name: "setup finished", timeout: time.Second, answer: []string{"alice", "room_one"}},
+		{name: "disabled", timeout: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.SetupTimeout = tt.timeout
+			server := startServer(t, cfg)
+			c := dial(t, server)
+			c.expect("Enter username: ")
+			for _, answer := range tt.answer {
+				c.send(answer)
+			}
+			if len(tt.answer) == 2 {
+				c.expect(" > ")
+			}
+
+			if tt.closed {
+				c.expect(fmt.Sprintf("No answer within %v, disconnecting.", tt.timeout))
+				c.expectClosed()
+				return
+			}
+			// Still connected well past the timeout.
+			c.refute("disconnecting", 1500*time.Millisecond)
+			if len(tt.answer) == 2 {
+				c.send("/prompt")
+				c.expect(" > ")
+			} else {
+				c.send("alice")
+				c.expect("Enter room name: ")
+			}
+		})
+	}
+}
+
+func TestServersKeepTheirOwnSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		set      func(cfg *Config)
+		invalid  string
+		valid    string
+		errStart string
+		prompt   string
+	}{
+		{
+			name:     "defaults",
+			set:      func(cfg *Config) {},
+			invalid:  "bob",
+			valid:    "alice",
+			errStart: ColorError,
+			prompt:   "alice 🏠 ROOM_ONE",
+		},
+		{
+			name: "short and narrow names",
+			set: func(cfg *Config) {
+				cfg.MinUsernameLength = 3
+				cfg.NameDisplayWidth = 4
+			},
+			invalid:  "bo",
+			valid:    "roberto",
+			errStart: ColorError,
+			prompt:   "rob… 🏠 ROO…",
+		},
+		{
+			name:     "digits only",
+			set:      func(cfg *Config) { cfg.UsernamePattern = `^[0-9]+$` },
+			invalid:  "alice",
+			valid:    "12345",
+			errStart: ColorError,
+			prompt:   "12345 🏠 ROOM_ONE",
+		},
+		{
+			name:     "spaced",
+			set:      func(cfg *Config) { cfg.LineSpacing = spacingSpaced },
+			invalid:  "bob",
+			valid:    "alice",
+			errStart: "\n" + ColorError,
+			prompt:   "alice 🏠 ROOM_ONE",
+		},
+	}
+
+	// All the servers run at once, so that settings leaking from one
+	// to another would show.
+	servers := make([]*Server, len(tests))
+	for i, tt := range tests {
+		cfg := DefaultConfig()
+		tt.set(&cfg)
+		servers[i] = startServer(t, cfg)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dial(t, servers[i])
+			c.expect("Enter username: ")
+			c.send(tt.invalid)
+			if out := c.expect("❌ Invalid username"); !strings.HasPrefix(out, tt.errStart) {
+				t.Errorf("error = %q, want it to start with %q", out, tt.errStart)
+			}
+			c.expect("Enter username: ")
+			c.send(tt.valid)
+			c.expect("Enter room name: ")
+			c.send("room_one")
+			c.expect(tt.prompt + ColorReset + " > ")
+		})
+	}
+}
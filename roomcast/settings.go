@@ -0,0 +1,229 @@
+package roomcast
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// maxStatusLength is the maximum number of characters in a status.
+const maxStatusLength = 50
+
+func init() {
+	registerCommand("echo", echoCommand)
+	registerCommand("bell", bellCommand)
+	registerCommand("status", statusCommand)
+	registerCommand("nick", nickCommand)
+	registerCommand("settings", settingsCommand)
+}
+
+// echoCommand handles "/echo on|off": when on, the client's own
+// messages are delivered back to it like everyone else's.
+func echoCommand(c *Client, args []string) {
+	on, ok := parseToggle(args)
+	if !ok {
+		c.writeError(CodeUsage, "Usage: /echo on|off")
+		return
+	}
+
+	c.mu.Lock()
+	c.echo = on
+	c.mu.Unlock()
+
+	if on {
+		c.writeMessage([]byte("🔁 Your messages will be echoed back to you.\n"))
+	} else {
+		c.writeMessage([]byte("🔁 Your messages will no longer be echoed back to you.\n"))
+	}
+}
+
+// bellCommand handles "/bell on|off": when on, keyword alerts also
+// ring the terminal bell.
+func bellCommand(c *Client, args []string) {
+	on, ok := parseToggle(args)
+	if !ok {
+		c.writeError(CodeUsage, "Usage: /bell on|off")
+		return
+	}
+
+	c.mu.Lock()
+	c.bell = on
+	c.mu.Unlock()
+
+	if on {
+		c.writeMessage([]byte("🔔 Alerts will ring the bell.\n"))
+	} else {
+		c.writeMessage([]byte("🔕 Alerts will no longer ring the bell.\n"))
+	}
+}
+
+// statusCommand handles "/status [text]": it sets the status shown
+// next to the client's name in member lists, or clears it.
+func statusCommand(c *Client, args []string) {
+	status := sanitizeText(strings.Join(args, " "), maxStatusLength)
+
+	c.mu.Lock()
+	c.status = status
+	c.mu.Unlock()
+
+	if status == "" {
+		c.writeMessage([]byte("💬 Status cleared.\n"))
+		return
+	}
+	c.writeMessage([]byte(fmt.Sprintf("💬 Status set to: %s\n", status)))
+}
+
+// nickCommand handles "/nick <name>": it renames the client unless
+// another member of one of its rooms already has that name. The name is
+// first reserved in every room, by their goroutines, so that nobody can
+// take it in one of them while the client is renamed.
+func nickCommand(c *Client, args []string) {
+	if len(args) != 1 || !c.server.isValidUsername(args[0]) {
+		c.writeError(CodeInvalidName, fmt.Sprintf("Usage: /nick <name> (%s).", c.server.usernameRules()))
+		return
+	}
+	name := strings.ToLower(args[0])
+	old := c.name()
+	if name == old {
+		c.writeMessage([]byte(fmt.Sprintf("🏷️ You are already %s.\n", name)))
+		return
+	}
+
+	if owned := c.server.roomOwnedBy(name, c); owned != nil {
+		c.writeError(CodeNameTaken, fmt.Sprintf("The name %s is the owner of %s.", name, owned.name))
+		return
+	}
+
+	var reserved []*Room
+	defer func() {
+		for _, room := range reserved {
+			room.do(func() {
+				if room.renames[name] == c {
+					delete(room.renames, name)
+				}
+			})
+		}
+	}()
+	for _, room := range c.joinedRooms() {
+		free := false
+		stopped := !room.do(func() {
+			if member := room.member(name); member != nil && member != c {
+				return
+			}
+			if holder := room.renames[name]; holder != nil && holder != c {
+				return
+			}
+			room.renames[name] = c
+			free = true
+		})
+		if stopped {
+			continue
+		}
+		if !free {
+			c.writeError(CodeNameTaken, fmt.Sprintf("The name %s is already taken in %s.", name, room.name))
+			return
+		}
+		reserved = append(reserved, room)
+	}
+
+	c.mu.Lock()
+	c.username = name
+	c.mu.Unlock()
+	c.switchRoom(c.currentRoom())
+
+	slog.Info("🏷️ Username changed", "user", name, "old", old)
+	notice := &Message{
+		Content: fmt.Sprintf("📢 %s is now known as %s.\n", old, name),
+		Sender:  name,
+		Type:    NotificationType,
+	}
+	for _, joined := range c.joinedRooms() {
+		joined.do(func() {
+			notice.Room = joined.name
+			joined.broadcast(notice, nil)
+		})
+	}
+}
+
+// settingsCommand handles "/settings": it shows the client's current
+// preferences, grouped by what they affect, marking those left at
+// their default.
+func settingsCommand(c *Client, args []string) {
+	c.mu.Lock()
+	username, status, admin := c.username, c.status, c.admin
+	echo, bell := c.echo, c.bell
+	paused, held := c.paused, len(c.held)
+	watches := slices.Clone(c.watches)
+	c.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("⚙️ Your settings:\n")
+
+	b.WriteString("👤 Profile\n")
+	fmt.Fprintf(&b, "  username: %s\n", username)
+	fmt.Fprintf(&b, "  status: %s\n", orDefaultSetting(status != "", status, "none"))
+	fmt.Fprintf(&b, "  admin: %s\n", orDefaultSetting(admin, "yes", "no"))
+
+	b.WriteString("🖥️ Display\n")
+	fmt.Fprintf(&b, "  emoji: %s\n", toggleSetting(c.caps.emoji, defaultCapabilities.emoji))
+	fmt.Fprintf(&b, "  color: %s\n", toggleSetting(c.caps.color, defaultCapabilities.color))
+	fmt.Fprintf(&b, "  framing: %s\n", toggleSetting(c.caps.framing, c.server.cfg.Protocol == protocolFramed))
+	fmt.Fprintf(&b, "  compression: %s\n", toggleSetting(isCompressed(c.conn), false))
+
+	b.WriteString("📨 Messages\n")
+	fmt.Fprintf(&b, "  echo: %s\n", toggleSetting(echo, false))
+	fmt.Fprintf(&b, "  paused: %s\n", orDefaultSetting(paused, fmt.Sprintf("yes, %d held", held), "no"))
+	fmt.Fprintf(&b, "  watches: %s\n", orDefaultSetting(len(watches) > 0, strings.Join(watches, ", "), "none"))
+	fmt.Fprintf(&b, "  bell: %s\n", toggleSetting(bell, false))
+
+	c.writeMessage([]byte(b.String()))
+}
+
+// toggleSetting shows an on/off setting, marked when it is at its default.
+func toggleSetting(on, def bool) string {
+	value := "off"
+	if on {
+		value = "on"
+	}
+	if on == def {
+		value += " (default)"
+	}
+	return value
+}
+
+// orDefaultSetting shows value when a setting is set, or its default
+// marked as such.
+func orDefaultSetting(set bool, value, def string) string {
+	if set {
+		return value
+	}
+	return def + " (default)"
+}
+
+// label returns the client's name followed by its status, if any,
+// as shown in member lists.
+func (c *Client) label() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.status == "" {
+		return c.username
+	}
+	return fmt.Sprintf("%s (%s)", c.username, c.status)
+}
+
+// parseToggle parses a single "on" or "off" argument.
+func parseToggle(args []string) (bool, bool) {
+	if len(args) != 1 {
+		return false, false
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "on":
+		return true, true
+	case "off":
+		return false, true
+	}
+	return false, false
+}
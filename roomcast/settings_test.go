@@ -0,0 +1,44 @@
+package roomcast
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNick(t *testing.T) {
+	tests := []struct {
+		name    string
+		nick    string
+		want    string
+		renamed bool
+	}{
+		{name: "taken in the current room", nick: "erina", want: "The name erina is already taken in ROOM_TWO."},
+		{name: "taken in another joined room", nick: "david", want: "The name david is already taken in ROOM_ONE."},
+		{name: "free in every room", nick: "alicia", want: "alice is now known as alicia", renamed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			join(t, server, "bobby", "room_one")
+			join(t, server, "carol", "room_two")
+			david := join(t, server, "david", "room_one")
+			erina := join(t, server, "erina", "room_two")
+			alice := join(t, server, "alice", "room_one")
+			david.expect("alice has joined the room")
+			alice.send("/join room_two")
+			alice.expect("alice 🏠 ROOM_TWO" + ColorReset + " > ")
+			erina.expect("alice has joined the room")
+
+			alice.send("/nick " + tt.nick)
+			alice.expect(tt.want)
+			if !tt.renamed {
+				david.refute("is now known as", 200*time.Millisecond)
+				clientNamed(t, server, "alice")
+				return
+			}
+			david.expect(tt.want)
+			erina.expect(tt.want)
+			alice.expect(tt.nick + " 🏠 ROOM_TWO" + ColorReset + " > ")
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package roomcast
+
+import (
+	"sort"
+	"time"
+)
+
+// Stats is a snapshot of the server activity, ready to be encoded to JSON.
+type Stats struct {
+	Rooms       int           `json:"rooms"`
+	Clients     int           `json:"clients"`
+	PeakClients int           `json:"peak_clients"`
+	Messages    int64         `json:"messages"`
+	Uptime      time.Duration `json:"uptime_ns"`
+	PerRoom     []RoomStats   `json:"per_room"`
+}
+
+// RoomStats is the activity of a single room.
+type RoomStats struct {
+	Name     string `json:"name"`
+	Clients  int    `json:"clients"`
+	Messages int64  `json:"messages"`
+}
+
+// Stats returns a snapshot of the server activity. It only holds the
+// server lock to list the rooms and reads the room counters atomically,
+// so it never waits for a busy room.
+func (s *Server) Stats() Stats {
+	s.mu.RLock()
+	stats := Stats{
+		Rooms:       len(s.rooms),
+		Clients:     len(s.clients),
+		PeakClients: s.peakClients,
+		PerRoom:     make([]RoomStats, 0, len(s.rooms)),
+	}
+	for _, room := range s.rooms {
+		stats.PerRoom = append(stats.PerRoom, RoomStats{
+			Name:     room.name,
+			Clients:  int(room.memberCount.Load()),
+			Messages: room.forwarded.Load(),
+		})
+	}
+	s.mu.RUnlock()
+
+	stats.Messages = s.forwarded.Load()
+	stats.Uptime = time.Since(s.started)
+	sort.Slice(stats.PerRoom, func(i, j int) bool { return stats.PerRoom[i].Name < stats.PerRoom[j].Name })
+	return stats
+}
@@ -0,0 +1,51 @@
+package roomcast
+
+import (
+	"fmt"
+	"time"
+)
+
+// throughputWindow is the rolling window over which /throughput is measured.
+const throughputWindow = time.Minute
+
+func init() {
+	registerCommand("throughput", throughputCommand)
+}
+
+// recordForward accounts for a forwarded message of size bytes and
+// forgets those that left the window. It must only be called from
+// the room goroutine.
+func (r *Room) recordForward(now time.Time, size int) {
+	r.throughput = append(r.throughput, byteSample{at: now, size: size})
+
+	cutoff := now.Add(-throughputWindow)
+	for len(r.throughput) > 0 && !r.throughput[0].at.After(cutoff) {
+		r.throughput = r.throughput[1:]
+	}
+}
+
+// rates returns the messages and bytes per second forwarded by the
+// room over the window.
+func (r *Room) rates() (messages, bytes float64) {
+	r.do(func() {
+		cutoff := time.Now().Add(-throughputWindow)
+		for _, sample := range r.throughput {
+			if sample.at.After(cutoff) {
+				messages++
+				bytes += float64(sample.size)
+			}
+		}
+	})
+	seconds := throughputWindow.Seconds()
+	return messages / seconds, bytes / seconds
+}
+
+// throughputCommand handles "/throughput": it shows how many messages
+// and bytes per second the current room forwarded recently.
+func throughputCommand(c *Client, args []string) {
+	room := c.currentRoom()
+	messages, bytes := room.rates()
+
+	c.writeMessage([]byte(fmt.Sprintf("📊 %s over the last %v: %.2f messages/s, %.0f bytes/s\n",
+		room.name, throughputWindow, messages, bytes)))
+}
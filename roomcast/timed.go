@@ -0,0 +1,109 @@
+package roomcast
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minTimedTTL and maxTimedTTL bound the lifetime of a /timed message.
+const (
+	minTimedTTL = 5 * time.Second
+	maxTimedTTL = 24 * time.Hour
+)
+
+func init() {
+	registerCommand("timed", timedCommand)
+}
+
+// timedCommand handles "/timed <seconds> <text>": it posts a message
+// that is deleted from the history once the time is up.
+func timedCommand(c *Client, args []string) {
+	if len(args) < 2 {
+		c.writeError(CodeUsage, "Usage: /timed <seconds> <text>")
+		return
+	}
+	seconds, err := strconv.Atoi(args[0])
+	ttl := time.Duration(seconds) * time.Second
+	if err != nil || ttl < minTimedTTL || ttl > maxTimedTTL {
+		c.writeError(CodeUsage, fmt.Sprintf("A timed message lasts between %d and %d seconds.", int(minTimedTTL.Seconds()), int(maxTimedTTL.Seconds())))
+		return
+	}
+
+	msg := NewMessage(strings.Join(args[1:], " "), c.name(), UserMessageType)
+	msg.Expires = msg.Timestamp.Add(ttl)
+	c.postMessage(msg)
+}
+
+// expired reports whether msg is a timed message whose time is up.
+func (m Message) expired(now time.Time) bool {
+	return !m.Expires.IsZero() && !now.Before(m.Expires)
+}
+
+// scheduleExpiry deletes msg once it expires.
+func (r *Room) scheduleExpiry(msg Message) {
+	time.AfterFunc(time.Until(msg.Expires), func() {
+		r.do(func() { r.expire(msg.ID) })
+	})
+}
+
+// expire deletes the message with the given ID from the recent
+// messages and the history file, and tells the members so that
+// clients able to do it remove it. It must only be called from the
+// room goroutine.
+func (r *Room) expire(id string) {
+	r.mu.Lock()
+	for i, msg := range r.recent {
+		if msg.ID == id {
+			r.recent = append(r.recent[:i:i], r.recent[i+1:]...)
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	r.historyMu.Lock()
+	if err := r.deleteFromHistory(id); err != nil {
+		slog.Error("❌ Error deleting message from history", "id", id, "err", err)
+	}
+	r.historyMu.Unlock()
+
+	r.broadcast(&Message{
+		Content: id,
+		Type:    DeleteType,
+		Room:    r.name,
+	}, nil)
+}
+
+// deleteFromHistory rewrites the history file without the message with
+// the given ID. r.historyMu must be held.
+func (r *Room) deleteFromHistory(id string) error {
+	lines, err := readHistoryLines(r.historyFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.HasPrefix(line, "{") {
+			if msg, err := FromJSON([]byte(line)); err == nil && msg.ID == id {
+				continue
+			}
+		}
+		kept = append(kept, line)
+	}
+	if len(kept) == len(lines) {
+		return nil
+	}
+
+	if err := writeHistoryLines(r.historyFile, kept); err != nil {
+		return err
+	}
+	r.historyLines = len(kept)
+	return nil
+}
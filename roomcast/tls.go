@@ -0,0 +1,70 @@
+package roomcast
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// tlsHandshakeTimeout bounds how long a client may take to complete the
+// TLS handshake.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// loadTLSConfig loads the certificate and key of Config.TLSCert and
+// Config.TLSKey. It returns nil when neither is set, so the server
+// falls back to plain TCP.
+func loadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("the TLS certificate and key must be given together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// bufferedConn is a connection whose input is read from r, which
+// starts with the bytes already buffered before the switch.
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// startTLS runs the server side of the TLS handshake on conn. reader is
+// the reader used on conn so far: its buffered bytes are kept as the
+// start of the handshake, and it is reset to read decrypted data.
+//
+// The handshake is done per connection rather than by wrapping the
+// listener so that a PROXY header, which load balancers send in the
+// clear before the handshake, can be read first.
+func startTLS(conn net.Conn, reader *bufio.Reader, cfg *tls.Config) (net.Conn, error) {
+	buffered, _ := reader.Peek(reader.Buffered())
+	tc := tls.Server(&bufferedConn{
+		Conn: conn,
+		r:    io.MultiReader(bytes.NewReader(bytes.Clone(buffered)), conn),
+	}, cfg)
+
+	conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+	if err := tc.Handshake(); err != nil {
+		return nil, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+
+	reader.Reset(tc)
+	return tc, nil
+}
@@ -0,0 +1,149 @@
+package roomcast
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate for localhost and
+// its key to a temporary directory, returning their paths and a pool
+// trusting the certificate.
+func writeCertificate(t *testing.T) (certFile, keyFile string, roots *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots = x509.NewCertPool()
+	roots.AddCert(cert)
+	return certFile, keyFile, roots
+}
+
+func TestTLS(t *testing.T) {
+	tests := []struct {
+		name  string
+		proxy bool
+	}{
+		{name: "direct"},
+		{name: "behind a PROXY header", proxy: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certFile, keyFile, roots := writeCertificate(t)
+			cfg := DefaultConfig()
+			cfg.TLSCert, cfg.TLSKey = certFile, keyFile
+			cfg.ProxyProtocol = tt.proxy
+			server := startServer(t, cfg)
+
+			dialTLS := func() *testClient {
+				c := dial(t, server)
+				if tt.proxy {
+					if _, err := c.conn.Write([]byte("PROXY TCP4 203.0.113.7 10.0.0.1 51234 4000\r\n")); err != nil {
+						t.Fatal(err)
+					}
+				}
+				c.conn = tls.Client(c.conn, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+				return c
+			}
+			alice := dialTLS()
+			alice.setup("alice", "room_one")
+			bobby := dialTLS()
+			bobby.setup("bobby", "room_one")
+			alice.expect("bobby has joined the room")
+
+			bobby.send("hello over TLS")
+			alice.expect("💬 hello over TLS")
+
+			// Clients that don't speak TLS never get the prompts.
+			plain := dial(t, server)
+			if tt.proxy {
+				plain.send("PROXY TCP4 203.0.113.8 10.0.0.1 51235 4000\r")
+			}
+			plain.send("carol")
+			plain.expectClosed()
+			if out := string(plain.pending); strings.Contains(out, "Enter username") {
+				t.Errorf("plain client got the prompts: %q", out)
+			}
+		})
+	}
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	certFile, keyFile, _ := writeCertificate(t)
+	tests := []struct {
+		name      string
+		cert, key string
+		wantTLS   bool
+		wantErr   bool
+	}{
+		{name: "plain TCP"},
+		{name: "certificate and key", cert: certFile, key: keyFile, wantTLS: true},
+		{name: "certificate only", cert: certFile, wantErr: true},
+		{name: "key only", key: keyFile, wantErr: true},
+		{name: "missing files", cert: certFile + ".missing", key: keyFile, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.TLSCert, cfg.TLSKey = tt.cert, tt.key
+			cfg.HistoryDir = t.TempDir()
+			server, err := NewServer(cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("NewServer succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			if got := server.tls != nil; got != tt.wantTLS {
+				t.Errorf("TLS on = %v, want %v", got, tt.wantTLS)
+			}
+		})
+	}
+}
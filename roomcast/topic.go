@@ -0,0 +1,80 @@
+package roomcast
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// maxTopicLength is the maximum number of characters in a room's topic.
+const maxTopicLength = 200
+
+func init() {
+	registerCommand("topic", topicCommand)
+}
+
+// topicFile returns the path of the file holding the room's topic.
+func (r *Room) topicFile() string {
+	return r.historyFile + ".topic"
+}
+
+// loadTopic restores the topic saved by a previous run.
+func (r *Room) loadTopic() {
+	data, err := os.ReadFile(r.topicFile())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("❌ Error reading topic", "room", r.name, "err", err)
+		}
+		return
+	}
+	r.topic = sanitizeText(string(data), maxTopicLength)
+}
+
+// currentTopic returns the room's topic, "" if it has none.
+func (r *Room) currentTopic() string {
+	var topic string
+	r.do(func() { topic = r.topic })
+	return topic
+}
+
+// sendTopic shows the topic of the room to a client that just joined it.
+func (r *Room) sendTopic(client *Client) {
+	if topic := r.currentTopic(); topic != "" {
+		client.writeMessage([]byte(fmt.Sprintf("📝 Topic: %s\n", topic)))
+	}
+}
+
+// topicCommand handles "/topic [text]": it shows the topic of the
+// current room, or sets it and tells the members.
+func topicCommand(c *Client, args []string) {
+	room := c.currentRoom()
+	if len(args) == 0 {
+		if topic := room.currentTopic(); topic != "" {
+			c.writeMessage([]byte(fmt.Sprintf("📝 Topic of %s: %s\n", room.name, topic)))
+		} else {
+			c.writeMessage([]byte(fmt.Sprintf("📝 %s has no topic yet, set one with /topic <text>.\n", room.name)))
+		}
+		return
+	}
+
+	topic := sanitizeText(strings.Join(args, " "), maxTopicLength)
+	if topic == "" {
+		c.writeError(CodeUsage, "Usage: /topic [text]")
+		return
+	}
+
+	room.do(func() {
+		room.topic = topic
+		if err := os.WriteFile(room.topicFile(), []byte(topic+"\n"), 0644); err != nil {
+			slog.Error("❌ Error saving topic", "room", room.name, "err", err)
+		}
+		room.broadcast(&Message{
+			Content: fmt.Sprintf("📢 Topic changed to: %s\n", topic),
+			Sender:  c.name(),
+			Type:    NotificationType,
+			Room:    room.name,
+		}, nil)
+	})
+	slog.Info("📝 Topic set", "user", c.name(), "room", room.name, "topic", topic)
+}
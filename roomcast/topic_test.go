@@ -0,0 +1,71 @@
+package roomcast
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTopic(t *testing.T) {
+	long := strings.Repeat("é", maxTopicLength+20)
+
+	tests := []struct {
+		name    string
+		command string
+		notice  string
+		topic   string
+	}{
+		{name: "set", command: "/topic Weekly planning", notice: "📢 Topic changed to: Weekly planning", topic: "Weekly planning"},
+		{name: "control characters", command: "/topic ring\x07the\x1b[31mbell", notice: "📢 Topic changed to: ring the [31mbell", topic: "ring the [31mbell"},
+		{name: "too long", command: "/topic " + long, notice: "📢 Topic changed to: " + long[:2*maxTopicLength] + ColorReset, topic: long[:2*maxTopicLength]},
+		{name: "only control characters", command: "/topic \x07\x07", notice: "Usage: /topic [text]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			alice := join(t, server, "alice", "room_one")
+			bobby := join(t, server, "bobby", "room_one")
+
+			alice.send("/topic")
+			alice.expect("📝 ROOM_ONE has no topic yet")
+
+			alice.send(tt.command)
+			alice.expect(tt.notice)
+			if tt.topic == "" {
+				if got := server.Room("ROOM_ONE").currentTopic(); got != "" {
+					t.Errorf("topic = %q, want none", got)
+				}
+				return
+			}
+			bobby.expect(tt.notice)
+
+			bobby.send("/topic")
+			bobby.expect("📝 Topic of ROOM_ONE: " + tt.topic + "\n")
+
+			carol := dial(t, server)
+			if out := carol.setup("carol", "room_one"); !strings.Contains(out, "📝 Topic: "+tt.topic+"\n") {
+				t.Errorf("carol's join = %q, want the topic", out)
+			}
+
+			saved, err := os.ReadFile(server.Room("ROOM_ONE").topicFile())
+			if err != nil {
+				t.Fatalf("reading the saved topic: %v", err)
+			}
+			if string(saved) != tt.topic+"\n" {
+				t.Errorf("saved topic = %q, want %q", saved, tt.topic)
+			}
+
+			// The topic is loaded again when the room is created.
+			restarted, err := NewServer(server.cfg)
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			room := newRoom("ROOM_ONE", restarted)
+			go room.run()
+			defer room.stop()
+			if got := room.currentTopic(); got != tt.topic {
+				t.Errorf("topic after a restart = %q, want %q", got, tt.topic)
+			}
+		})
+	}
+}
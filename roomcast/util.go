@@ -0,0 +1,124 @@
+package roomcast
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultMinUsernameLength = 5
+	defaultMaxUsernameLength = 8
+
+	minRoomNameLength = 5
+	maxRoomNameLength = 20
+
+	// defaultNamePattern is the character set allowed in usernames
+	// and room names unless configured otherwise.
+	defaultNamePattern = `^[a-zA-Z0-9_]+$`
+
+	defaultNameDisplayWidth = 20
+)
+
+// compileNamePatterns compiles the patterns usernames and room names
+// must match.
+func compileNamePatterns(username, roomName string) (userRe, roomRe *regexp.Regexp, err error) {
+	userRe, err = regexp.Compile(username)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid username pattern: %w", err)
+	}
+	roomRe, err = regexp.Compile(roomName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid room name pattern: %w", err)
+	}
+	return userRe, roomRe, nil
+}
+
+// usernameRules describes the usernames accepted, for error messages.
+func (s *Server) usernameRules() string {
+	return fmt.Sprintf("%d-%d characters matching %s", s.cfg.MinUsernameLength, s.cfg.MaxUsernameLength, s.usernamePattern)
+}
+
+// roomNameRules describes the room names accepted, for error messages.
+func (s *Server) roomNameRules() string {
+	return fmt.Sprintf("%d-%d characters matching %s", minRoomNameLength, maxRoomNameLength, s.roomNamePattern)
+}
+
+// isValidUsername checks if the username is valid: between
+// Config.MinUsernameLength and Config.MaxUsernameLength characters,
+// matching Config.UsernamePattern. Lengths are counted in characters,
+// not bytes, so Unicode names are measured fairly.
+func (s *Server) isValidUsername(username string) bool {
+	length := utf8.RuneCountInString(username)
+	if length < s.cfg.MinUsernameLength || length > s.cfg.MaxUsernameLength {
+		return false
+	}
+	return s.usernamePattern.MatchString(username)
+}
+
+// isValidRoomName checks if the room name is valid: between minRoomNameLength
+// and maxRoomNameLength characters, matching Config.RoomNamePattern.
+func (s *Server) isValidRoomName(roomName string) bool {
+	length := utf8.RuneCountInString(roomName)
+	if length < minRoomNameLength || length > maxRoomNameLength {
+		return false
+	}
+	return s.roomNamePattern.MatchString(roomName)
+}
+
+// displayName shortens a username or room name to Config.NameDisplayWidth
+// characters for display only. The full name is still used everywhere
+// names are compared.
+func (s *Server) displayName(name string) string {
+	return shortenName(name, s.cfg.NameDisplayWidth)
+}
+
+// shortenName shortens name to width characters, ending with an
+// ellipsis. A width of zero leaves it in full.
+func shortenName(name string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(name) <= width {
+		return name
+	}
+	if width == 1 {
+		return "…"
+	}
+	return string([]rune(name)[:width-1]) + "…"
+}
+
+// sanitizeFilename strips path separators and parent directory
+// references from name so that, joined to a directory, it always
+// names a file directly inside it. It fails if nothing usable is left.
+func sanitizeFilename(name string) (string, error) {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == 0 {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.ReplaceAll(name, "..", "")
+
+	if name == "" || name == "." {
+		return "", fmt.Errorf("no usable file name left")
+	}
+	return name, nil
+}
+
+// sanitizeText removes control characters, such as ANSI escape
+// sequences or newlines, from text typed by a user, collapses spaces
+// and cuts it to at most max characters.
+func sanitizeText(text string, max int) string {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, text)
+	text = strings.Join(strings.Fields(text), " ")
+
+	if runes := []rune(text); len(runes) > max {
+		text = strings.TrimSpace(string(runes[:max]))
+	}
+	return text
+}
@@ -0,0 +1,39 @@
+package roomcast
+
+import "testing"
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "history_ROOM_ONE", want: "history_ROOM_ONE"},
+		{name: "../../etc/passwd", want: "etcpasswd"},
+		{name: `..\..\windows\win.ini`, want: "windowswin.ini"},
+		{name: "a/b\\c", want: "abc"},
+		{name: "nul\x00byte", want: "nulbyte"},
+		{name: "", wantErr: true},
+		{name: "/", wantErr: true},
+		{name: "..", wantErr: true},
+		{name: "...", wantErr: true},
+		{name: "../..", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sanitizeFilename(tt.name)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("sanitizeFilename(%q) = %q, want an error", tt.name, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sanitizeFilename(%q): %v", tt.name, err)
+			}
+			if got != tt.want {
+				t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package roomcast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxWatches bounds the keywords a client can watch.
+const maxWatches = 20
+
+func init() {
+	registerCommand("watch", watchCommand)
+	registerCommand("unwatch", unwatchCommand)
+}
+
+// watchedKeyword returns the first watched keyword found in content,
+// ignoring case, or "" if there is none.
+func (c *Client) watchedKeyword(content string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	content = strings.ToLower(content)
+	for _, keyword := range c.watches {
+		if strings.Contains(content, keyword) {
+			return keyword
+		}
+	}
+	return ""
+}
+
+// watchCommand handles "/watch [keyword]": it alerts the client about
+// messages containing the keyword, or lists the watched keywords.
+func watchCommand(c *Client, args []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(args) == 0 {
+		if len(c.watches) == 0 {
+			c.writeMessage([]byte("👀 You are not watching any keyword. Usage: /watch <keyword>\n"))
+			return
+		}
+		c.writeMessage([]byte(fmt.Sprintf("👀 Watching: %s\n", strings.Join(c.watches, ", "))))
+		return
+	}
+
+	keyword := strings.ToLower(strings.Join(args, " "))
+	for _, w := range c.watches {
+		if w == keyword {
+			c.writeMessage([]byte(fmt.Sprintf("👀 You are already watching %q.\n", keyword)))
+			return
+		}
+	}
+	if len(c.watches) >= maxWatches {
+		c.writeError(CodeLimitReached, fmt.Sprintf("You can watch at most %d keywords.", maxWatches))
+		return
+	}
+
+	c.watches = append(c.watches, keyword)
+	c.writeMessage([]byte(fmt.Sprintf("👀 You will be alerted about messages containing %q.\n", keyword)))
+}
+
+// unwatchCommand handles "/unwatch <keyword>".
+func unwatchCommand(c *Client, args []string) {
+	if len(args) == 0 {
+		c.writeError(CodeUsage, "Usage: /unwatch <keyword>")
+		return
+	}
+	keyword := strings.ToLower(strings.Join(args, " "))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, w := range c.watches {
+		if w == keyword {
+			c.watches = append(c.watches[:i], c.watches[i+1:]...)
+			c.writeMessage([]byte(fmt.Sprintf("👀 No longer watching %q.\n", keyword)))
+			return
+		}
+	}
+	c.writeError(CodeNotFound, fmt.Sprintf("You are not watching %q.", keyword))
+}
@@ -0,0 +1,363 @@
+package roomcast
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes, see RFC 6455 section 5.2.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// wsGUID is appended to the client's key to compute the handshake answer.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWSMessageSize bounds the messages a WebSocket client can send, so
+// a single frame can't make the server allocate without limit.
+const maxWSMessageSize = 64 << 10
+
+var errWSProtocol = errors.New("websocket protocol error")
+
+// startWebSocket serves the WebSocket gateway on Config.WSAddr, if set,
+// so browsers can connect. It uses TLS when the server does.
+func (s *Server) startWebSocket() error {
+	if s.cfg.WSAddr == "" {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", s.cfg.WSAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for WebSocket clients: %w", err)
+	}
+	if s.tls != nil {
+		ln = tls.NewListener(ln, s.tls)
+	}
+	s.mu.Lock()
+	s.wsListener = ln
+	s.mu.Unlock()
+	slog.Info("🌍 Listening for WebSocket clients", "addr", ln.Addr())
+
+	httpServer := &http.Server{
+		Handler:           http.HandlerFunc(s.handleWebSocket),
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          log.New(io.Discard, "", 0),
+	}
+	go httpServer.Serve(ln)
+	return nil
+}
+
+// handleWebSocket upgrades a request to WebSocket and admits the client
+// to a room. The username and room come from the query string, e.g.
+// ws://host:11112/?username=alice&room=LOBBY, since browsers can't
+// answer the prompts terminal clients get.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "This endpoint only accepts WebSocket connections.", http.StatusUpgradeRequired)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version.", http.StatusBadRequest)
+		return
+	}
+
+	username, roomName := r.URL.Query().Get("username"), r.URL.Query().Get("room")
+	if !s.isValidUsername(username) {
+		http.Error(w, fmt.Sprintf("Invalid username. Must be %s.", s.usernameRules()), http.StatusBadRequest)
+		return
+	}
+	if !s.isValidRoomName(roomName) {
+		http.Error(w, fmt.Sprintf("Invalid room name. Must be %s.", s.roomNameRules()), http.StatusBadRequest)
+		return
+	}
+	if room := s.Room(roomName); room != nil {
+		err := s.tryPassword(room, addrIP(r.RemoteAddr), r.URL.Query().Get("password"))
+		if errors.Is(err, errTooManyPasswords) {
+			http.Error(w, "Too many wrong room passwords, try again later.", http.StatusTooManyRequests)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Wrong room password.", http.StatusForbidden)
+			return
+		}
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket upgrade not supported.", http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		slog.Error("🚨 WebSocket upgrade failed", "addr", r.RemoteAddr, "err", err)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	conn, allowed := s.countConn(conn)
+	if !allowed {
+		slog.Warn("🚨 Rejected connection", "addr", conn.RemoteAddr(), "err", "too many connections from its address")
+		fmt.Fprintf(buf, "HTTP/1.1 429 Too Many Requests\r\nContent-Type: text/plain; charset=utf-8\r\nConnection: close\r\n\r\nToo many connections from your address (at most %d).\n", s.cfg.MaxConnsPerIP)
+		buf.Flush()
+		conn.Close()
+		return
+	}
+
+	accept := sha1.Sum([]byte(key + wsGUID))
+	fmt.Fprintf(buf, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(accept[:]))
+	if err := buf.Flush(); err != nil {
+		conn.Close()
+		return
+	}
+
+	s.metrics.connections.Inc()
+	ws := &wsConn{Conn: conn, r: buf.Reader}
+	s.emit(Event{Type: EventClientConnected, RemoteAddr: ws.RemoteAddr().String()})
+	if err := s.admit(ws, bufio.NewReader(ws), strings.ToLower(username), strings.ToUpper(roomName)); err != nil {
+		ws.Close()
+		s.emit(Event{Type: EventClientDisconnected, Username: strings.ToLower(username), RemoteAddr: ws.RemoteAddr().String()})
+	}
+}
+
+// headerContains reports whether the comma-separated values of header
+// name include value, ignoring case.
+func headerContains(header http.Header, name, value string) bool {
+	for _, line := range header.Values(name) {
+		for _, v := range strings.Split(line, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsConn is a WebSocket connection. Reading it returns the text of each
+// message the client sends followed by a newline, so it is read like a
+// TCP client's lines. As a transport, it sends every room message as a
+// text frame holding the JSON Message, and server text as a
+// Notification message.
+type wsConn struct {
+	net.Conn
+
+	// r reads frames from the client. It is only used by the client's
+	// read goroutine.
+	r *bufio.Reader
+
+	// pending holds the part of the last message not read yet.
+	pending []byte
+
+	// mu serializes frame writes, which come from several goroutines,
+	// and guards closeSent, set once a close frame has been sent.
+	mu        sync.Mutex
+	closeSent bool
+
+	closeOnce sync.Once
+}
+
+func (ws *wsConn) Read(p []byte) (int, error) {
+	for len(ws.pending) == 0 {
+		msg, err := ws.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		ws.pending = append(msg, '\n')
+	}
+	n := copy(p, ws.pending)
+	ws.pending = ws.pending[n:]
+	return n, nil
+}
+
+// readMessage reads the next text message, joining its fragments and
+// answering the control frames received meanwhile.
+func (ws *wsConn) readMessage() ([]byte, error) {
+	var msg []byte
+	started := false
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsPing:
+			if err := ws.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			ws.writeFrame(wsClose, payload)
+			return nil, io.EOF
+		case wsBinary:
+			ws.closeWith(1003, "only text messages are supported")
+			return nil, fmt.Errorf("%w: binary message", errWSProtocol)
+		case wsText:
+			if started {
+				return nil, fmt.Errorf("%w: unfinished message", errWSProtocol)
+			}
+			started = true
+		case wsContinuation:
+			if !started {
+				return nil, fmt.Errorf("%w: unexpected continuation", errWSProtocol)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown opcode %d", errWSProtocol, opcode)
+		}
+
+		if len(msg)+len(payload) > maxWSMessageSize {
+			ws.closeWith(1009, "message too big")
+			return nil, fmt.Errorf("%w: message larger than %d bytes", errWSProtocol, maxWSMessageSize)
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// readFrame reads a single frame and unmasks its payload.
+func (ws *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode = header[0]&0x80 != 0, header[0]&0x0F
+	masked := header[1]&0x80 != 0
+	if !masked {
+		return false, 0, nil, fmt.Errorf("%w: unmasked client frame", errWSProtocol)
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxWSMessageSize {
+		ws.closeWith(1009, "message too big")
+		return false, 0, nil, fmt.Errorf("%w: frame larger than %d bytes", errWSProtocol, maxWSMessageSize)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame writes a single unfragmented frame. Frames sent by the
+// server are never masked.
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closeSent {
+		return net.ErrClosed
+	}
+	ws.closeSent = opcode == wsClose
+	_, err := ws.Conn.Write(frame)
+	return err
+}
+
+// Write sends p as a text message.
+func (ws *wsConn) Write(p []byte) (int, error) {
+	if err := ws.writeFrame(wsText, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// closeWith sends a close frame with the given status code and reason.
+func (ws *wsConn) closeWith(code uint16, reason string) {
+	payload := binary.BigEndian.AppendUint16(nil, code)
+	ws.writeFrame(wsClose, append(payload, reason...))
+}
+
+// Close sends a normal close frame and closes the connection. Rooms
+// close the connections of clients that can't keep up, so the close
+// frame is skipped rather than waited for when a write is in progress.
+func (ws *wsConn) Close() error {
+	err := net.ErrClosed
+	ws.closeOnce.Do(func() {
+		if ws.mu.TryLock() {
+			if !ws.closeSent {
+				ws.closeSent = true
+				ws.Conn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+				ws.Conn.Write([]byte{0x80 | wsClose, 2, 0x03, 0xE8}) // 1000, normal closure
+			}
+			ws.mu.Unlock()
+		}
+		err = ws.Conn.Close()
+	})
+	return err
+}
+
+// writeText sends server text as a Notification message.
+func (ws *wsConn) writeText(text []byte) error {
+	msg, ok := textNotification(text)
+	if !ok {
+		return nil
+	}
+	return ws.writeMessage(msg, nil)
+}
+
+// writeMessage sends msg as JSON.
+func (ws *wsConn) writeMessage(msg Message, rendered []byte) error {
+	return ws.writeFrame(wsText, msg.ToJSON())
+}
+
+// writePrompt does nothing: web clients draw their own input box.
+func (ws *wsConn) writePrompt(prompt string) error {
+	return nil
+}
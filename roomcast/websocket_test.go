@@ -0,0 +1,337 @@
+package roomcast
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsTestClient is a WebSocket client of a test server.
+type wsTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialWS opens a WebSocket connection to the gateway at url with the
+// given query and checks the handshake answer.
+func dialWS(t *testing.T, url, query string) *wsTestClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	const key = "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET /?%s HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", query, key)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("reading the handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %s, want 101", resp.Status)
+	}
+	accept := sha1.Sum([]byte(key + wsGUID))
+	if got, want := resp.Header.Get("Sec-WebSocket-Accept"), base64.StdEncoding.EncodeToString(accept[:]); got != want {
+		t.Fatalf("Sec-WebSocket-Accept = %q, want %q", got, want)
+	}
+	return &wsTestClient{t: t, conn: conn, r: r}
+}
+
+// writeFrame sends a frame, masked as clients must unless masked is false.
+func (ws *wsTestClient) writeFrame(fin bool, opcode byte, payload []byte, masked bool) {
+	ws.t.Helper()
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	if masked {
+		mask := [4]byte{0x37, 0xfa, 0x21, 0x3d}
+		frame = append(frame, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	if _, err := ws.conn.Write(frame); err != nil {
+		ws.t.Fatalf("writing a frame: %v", err)
+	}
+}
+
+// send sends text as a single masked text frame.
+func (ws *wsTestClient) send(text string) {
+	ws.t.Helper()
+	ws.writeFrame(true, wsText, []byte(text), true)
+}
+
+// readFrame reads the next frame sent by the server, which must not be
+// masked or fragmented.
+func (ws *wsTestClient) readFrame() (opcode byte, payload []byte, err error) {
+	ws.conn.SetReadDeadline(time.Now().Add(testTimeout))
+	var header [2]byte
+	if _, err := io.ReadFull(ws.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		ws.t.Fatalf("server frame header %x: want unmasked and final", header)
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload = make([]byte, length)
+	_, err = io.ReadFull(ws.r, payload)
+	return header[0] & 0x0F, payload, err
+}
+
+// expectFrame reads frames until one with opcode arrives and returns
+// its payload.
+func (ws *wsTestClient) expectFrame(opcode byte) []byte {
+	ws.t.Helper()
+	for {
+		got, payload, err := ws.readFrame()
+		if err != nil {
+			ws.t.Fatalf("waiting for opcode %d: %v", opcode, err)
+		}
+		if got == opcode {
+			return payload
+		}
+	}
+}
+
+// expectMessage reads messages until one whose content contains want
+// arrives, and returns it.
+func (ws *wsTestClient) expectMessage(want string) Message {
+	ws.t.Helper()
+	for {
+		msg, err := FromJSON(ws.expectFrame(wsText))
+		if err != nil {
+			ws.t.Fatalf("server sent an invalid message: %v", err)
+		}
+		if strings.Contains(msg.Content, want) {
+			return msg
+		}
+	}
+}
+
+// expectClose reads until the server sends a close frame, returns its
+// status code, and checks that the connection is closed after it.
+func (ws *wsTestClient) expectClose() uint16 {
+	ws.t.Helper()
+	payload := ws.expectFrame(wsClose)
+	if len(payload) < 2 {
+		ws.t.Fatalf("close frame without a status code: %x", payload)
+	}
+	for {
+		if _, _, err := ws.readFrame(); err != nil {
+			if isTimeout(err) {
+				ws.t.Fatal("connection still open after the close frame")
+			}
+			break
+		}
+	}
+	return binary.BigEndian.Uint16(payload)
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	upgrade := map[string]string{
+		"Connection":            "Upgrade",
+		"Upgrade":               "websocket",
+		"Sec-WebSocket-Key":     "dGhlIHNhbXBsZSBub25jZQ==",
+		"Sec-WebSocket-Version": "13",
+	}
+	with := func(name, value string) map[string]string {
+		headers := map[string]string{name: value}
+		for n, v := range upgrade {
+			if n != name {
+				headers[n] = v
+			}
+		}
+		return headers
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		headers map[string]string
+		want    int
+	}{
+		{name: "not an upgrade", query: "username=alice&room=room_one", want: http.StatusUpgradeRequired},
+		{name: "old version", query: "username=alice&room=room_one", headers: with("Sec-WebSocket-Version", "8"), want: http.StatusBadRequest},
+		{name: "missing key", query: "username=alice&room=room_one", headers: with("Sec-WebSocket-Key", ""), want: http.StatusBadRequest},
+		{name: "invalid username", query: "username=al&room=room_one", headers: upgrade, want: http.StatusBadRequest},
+		{name: "invalid room", query: "username=alice&room=r", headers: upgrade, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			gateway := httptest.NewServer(http.HandlerFunc(server.handleWebSocket))
+			t.Cleanup(gateway.Close)
+
+			req, err := http.NewRequest("GET", gateway.URL+"/?"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %s, want %d", resp.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, alice *wsTestClient, bobby *testClient)
+	}{
+		{
+			name: "masked text frames",
+			run: func(t *testing.T, alice *wsTestClient, bobby *testClient) {
+				alice.send("hello from the browser")
+				bobby.expect("🤖 alice 💬 hello from the browser")
+
+				bobby.send("hello from the terminal")
+				msg := alice.expectMessage("hello from the terminal")
+				if msg.Sender != "bobby" || msg.Type != UserMessageType || msg.Room != "ROOM_ONE" {
+					t.Errorf("got %+v, want a user message from bobby in ROOM_ONE", msg)
+				}
+			},
+		},
+		{
+			name: "fragmented message with a ping in between",
+			run: func(t *testing.T, alice *wsTestClient, bobby *testClient) {
+				alice.writeFrame(false, wsText, []byte("hello "), true)
+				alice.writeFrame(false, wsContinuation, []byte("in "), true)
+				alice.writeFrame(true, wsPing, []byte("are you there"), true)
+				if pong := alice.expectFrame(wsPong); string(pong) != "are you there" {
+					t.Errorf("pong = %q, want the ping's payload", pong)
+				}
+				alice.writeFrame(true, wsContinuation, []byte("fragments"), true)
+				bobby.expect("💬 hello in fragments")
+			},
+		},
+		{
+			name: "long message",
+			run: func(t *testing.T, alice *wsTestClient, bobby *testClient) {
+				long := strings.Repeat("x", 300)
+				alice.send(long)
+				bobby.expect("💬 " + long)
+			},
+		},
+		{
+			name: "command reply",
+			run: func(t *testing.T, alice *wsTestClient, bobby *testClient) {
+				alice.send("/who")
+				msg := alice.expectMessage("2 users online in ROOM_ONE")
+				if msg.Type != NotificationType {
+					t.Errorf("reply type = %s, want %s", msg.Type, NotificationType)
+				}
+			},
+		},
+		{
+			name: "close frame",
+			run: func(t *testing.T, alice *wsTestClient, bobby *testClient) {
+				alice.writeFrame(true, wsClose, []byte{0x03, 0xE8}, true)
+				if code := alice.expectClose(); code != 1000 {
+					t.Errorf("close code = %d, want 1000", code)
+				}
+				bobby.expect("alice has left the room")
+			},
+		},
+		{
+			name: "unmasked frame",
+			run: func(t *testing.T, alice *wsTestClient, bobby *testClient) {
+				alice.writeFrame(true, wsText, []byte("not masked"), false)
+				alice.expectClose()
+				bobby.expect("alice has left the room")
+			},
+		},
+		{
+			name: "binary message",
+			run: func(t *testing.T, alice *wsTestClient, bobby *testClient) {
+				alice.writeFrame(true, wsBinary, []byte{0, 1, 2}, true)
+				if code := alice.expectClose(); code != 1003 {
+					t.Errorf("close code = %d, want 1003", code)
+				}
+			},
+		},
+		{
+			name: "oversized frame",
+			run: func(t *testing.T, alice *wsTestClient, bobby *testClient) {
+				alice.writeFrame(true, wsText, make([]byte, maxWSMessageSize+1), true)
+				if code := alice.expectClose(); code != 1009 {
+					t.Errorf("close code = %d, want 1009", code)
+				}
+			},
+		},
+		{
+			name: "oversized fragments",
+			run: func(t *testing.T, alice *wsTestClient, bobby *testClient) {
+				alice.writeFrame(false, wsText, make([]byte, maxWSMessageSize/2+1), true)
+				alice.writeFrame(true, wsContinuation, make([]byte, maxWSMessageSize/2+1), true)
+				if code := alice.expectClose(); code != 1009 {
+					t.Errorf("close code = %d, want 1009", code)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t, DefaultConfig())
+			gateway := httptest.NewServer(http.HandlerFunc(server.handleWebSocket))
+			t.Cleanup(gateway.Close)
+
+			bobby := join(t, server, "bobby", "room_one")
+			alice := dialWS(t, gateway.URL, "username=alice&room=room_one")
+			bobby.expect("alice has joined the room")
+
+			tt.run(t, alice, bobby)
+		})
+	}
+}
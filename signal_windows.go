@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+)
+
+// notifyDiagnostics does nothing since Windows has no SIGUSR1.
+func notifyDiagnostics(c chan<- os.Signal) {}